@@ -0,0 +1,54 @@
+// Command conformance runs the distribution-spec conformance suite against a registry and reports which capabilities
+// it supports.
+//
+//	conformance [-json] [target]
+//
+// The target is a registry manifest URL or a Docker style image name, naming a repository set aside for the checks.
+// Without one the suite runs against an in-process registrytest.Registry, which is a quick way to see what it expects.
+// Credentials are read from the podman and docker auth files. The exit status is 1 if any check fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/vleurgat/dockerclient/pkg/client"
+	"github.com/vleurgat/dockerclient/pkg/config"
+	"github.com/vleurgat/dockerclient/pkg/conformance"
+	"github.com/vleurgat/dockerclient/pkg/registrytest"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "write the report as JSON")
+	flag.Parse()
+	if !run(flag.Arg(0), *asJSON) {
+		os.Exit(1)
+	}
+}
+
+// run runs the suite against the target, writing the report to stdout, and reports whether it passed.
+func run(target string, asJSON bool) bool {
+	if target == "" {
+		registry := registrytest.CreateRegistry()
+		defer registry.Close()
+		target = registry.ManifestURL("conformance", "latest")
+	}
+	dockerConfig, err := config.LoadAuthFiles(config.DefaultAuthFiles()...)
+	if err != nil {
+		log.Fatalln("failed to load credentials", err)
+	}
+	c := client.CreateClient(dockerConfig)
+	report := conformance.Run(&c, target)
+	if asJSON {
+		if err = report.WriteJSON(os.Stdout); err != nil {
+			log.Fatalln("failed to write report", err)
+		}
+	} else {
+		for _, result := range report.Results {
+			fmt.Printf("%-11s %-18s %-18s %s\n", result.Status, result.Category, result.Capability, result.Message)
+		}
+	}
+	return report.Passed()
+}
@@ -0,0 +1,247 @@
+package cache
+
+import (
+	_ "crypto/sha256" // register the hash used by digest.Canonical
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Cache is a content addressable store of blobs and manifests on disk. Content is keyed by its digest, so it never
+// goes stale; the least recently used content is evicted once the cache grows beyond its maximum size.
+type Cache struct {
+	dir     string
+	maxSize int64
+	mutex   sync.Mutex
+	entries map[digest.Digest]*entry
+	size    int64
+}
+
+type entry struct {
+	size     int64
+	accessed time.Time
+}
+
+// CreateCache creates a Cache in the directory, picking up any content already there. A maxSize of zero or less
+// means the cache is unbounded.
+func CreateCache(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{dir: dir, maxSize: maxSize, entries: make(map[digest.Digest]*entry)}
+	algorithms, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(dir, algorithm.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			d := digest.NewDigestFromEncoded(digest.Algorithm(algorithm.Name()), file.Name())
+			if file.Mode().IsRegular() && d.Validate() == nil {
+				c.entries[d] = &entry{size: file.Size(), accessed: file.ModTime()}
+				c.size += file.Size()
+			}
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.evict()
+	return c, nil
+}
+
+func (c *Cache) path(d digest.Digest) string {
+	return filepath.Join(c.dir, d.Algorithm().String(), d.Encoded())
+}
+
+// Get returns the content with the digest, or false if it isn't in the cache. Content that fails verification is
+// removed from the cache.
+func (c *Cache) Get(d digest.Digest) ([]byte, bool) {
+	reader, ok := c.Open(d)
+	if !ok {
+		return nil, false
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	return content, err == nil
+}
+
+// Open returns a reader for the content with the digest, or false if it isn't in the cache. The reader returns an
+// error at the end of the content if it fails verification, in which case it is removed from the cache.
+func (c *Cache) Open(d digest.Digest) (io.ReadCloser, bool) {
+	if d.Validate() != nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, exists := c.entries[d]
+	if !exists {
+		return nil, false
+	}
+	file, err := os.Open(c.path(d))
+	if err != nil {
+		c.remove(d)
+		return nil, false
+	}
+	e.accessed = time.Now()
+	os.Chtimes(c.path(d), e.accessed, e.accessed)
+	return &verifyingReader{file: file, verifier: d.Verifier(), cache: c, digest: d}, true
+}
+
+type verifyingReader struct {
+	file     *os.File
+	verifier digest.Verifier
+	cache    *Cache
+	digest   digest.Digest
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.verifier.Write(p[:n])
+	if err == io.EOF && !r.verifier.Verified() {
+		r.cache.mutex.Lock()
+		r.cache.remove(r.digest)
+		r.cache.mutex.Unlock()
+		return n, errors.New("cached content does not match digest " + r.digest.String())
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.file.Close()
+}
+
+// Put adds the content to the cache, provided it matches the digest.
+func (c *Cache) Put(d digest.Digest, content []byte) error {
+	w, err := c.Writer(d)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(content); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Commit()
+}
+
+// Writer is an io.WriteCloser that adds the content written to it to the cache once Commit is called.
+type Writer struct {
+	file     *os.File
+	verifier digest.Verifier
+	cache    *Cache
+	digest   digest.Digest
+	size     int64
+}
+
+// Writer returns a Writer for the content with the digest. Either Commit or Close must be called when done, unless a
+// Write has failed.
+func (c *Cache) Writer(d digest.Digest) (*Writer, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path(d)), 0755); err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{file: file, verifier: d.Verifier(), cache: c, digest: d}, nil
+}
+
+// Write writes to a temporary file. Content larger than the cache's maximum size is refused rather than flushing
+// everything else out of the cache, and the writer is closed once it passes the limit.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.file == nil {
+		return 0, errors.New("cache writer already closed")
+	}
+	if w.cache.maxSize > 0 && w.size+int64(len(p)) > w.cache.maxSize {
+		w.Close()
+		return 0, errors.New("content is larger than the cache - not caching " + w.digest.String())
+	}
+	n, err := w.file.Write(p)
+	w.verifier.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Close abandons the content written so far, unless it has already been committed.
+func (w *Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	os.Remove(w.file.Name())
+	w.file = nil
+	return err
+}
+
+// Commit verifies the content written against the digest and atomically moves it into the cache.
+func (w *Writer) Commit() error {
+	if w.file == nil {
+		return errors.New("cache writer already closed")
+	}
+	name := w.file.Name()
+	err := w.file.Close()
+	w.file = nil
+	if err == nil && !w.verifier.Verified() {
+		err = errors.New("content does not match digest " + w.digest.String())
+	}
+	if err == nil {
+		err = os.Rename(name, w.cache.path(w.digest))
+	}
+	if err != nil {
+		os.Remove(name)
+		return err
+	}
+	w.cache.mutex.Lock()
+	defer w.cache.mutex.Unlock()
+	if existing, exists := w.cache.entries[w.digest]; exists {
+		w.cache.size -= existing.size
+	}
+	w.cache.entries[w.digest] = &entry{size: w.size, accessed: time.Now()}
+	w.cache.size += w.size
+	w.cache.evict()
+	return nil
+}
+
+// remove deletes the content from the cache; the mutex must be held.
+func (c *Cache) remove(d digest.Digest) {
+	if e, exists := c.entries[d]; exists {
+		c.size -= e.size
+		delete(c.entries, d)
+	}
+	os.Remove(c.path(d))
+}
+
+// evict removes the least recently used content until the cache fits its maximum size; the mutex must be held.
+func (c *Cache) evict() {
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+	var digests []digest.Digest
+	for d := range c.entries {
+		digests = append(digests, d)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return c.entries[digests[i]].accessed.Before(c.entries[digests[j]].accessed)
+	})
+	for _, d := range digests {
+		if c.size <= c.maxSize {
+			break
+		}
+		c.remove(d)
+	}
+}
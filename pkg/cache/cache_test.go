@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func createTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal("failed to create temp dir", err)
+	}
+	return dir
+}
+
+func TestCache(t *testing.T) {
+	t.Run("put and get", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, err := CreateCache(dir, 0)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if _, ok := cache.Get(digest.FromString("hello")); ok {
+			t.Error("expected cache miss")
+		}
+		if err = cache.Put(digest.FromString("hello"), []byte("hello")); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		content, ok := cache.Get(digest.FromString("hello"))
+		if !ok || string(content) != "hello" {
+			t.Errorf("expected hello; got %s", content)
+		}
+	})
+
+	t.Run("wrong digest", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, _ := CreateCache(dir, 0)
+		err := cache.Put(digest.FromString("hello"), []byte("goodbye"))
+		if err == nil || !strings.Contains(err.Error(), "does not match digest") {
+			t.Errorf("expected does not match digest; got %s", err)
+		}
+		if _, ok := cache.Get(digest.FromString("hello")); ok {
+			t.Error("expected cache miss")
+		}
+	})
+
+	t.Run("corrupt content", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, _ := CreateCache(dir, 0)
+		d := digest.FromString("hello")
+		cache.Put(d, []byte("hello"))
+		ioutil.WriteFile(cache.path(d), []byte("HELLO"), 0644)
+		if _, ok := cache.Get(d); ok {
+			t.Error("expected corrupt content to be a cache miss")
+		}
+		if _, err := os.Stat(cache.path(d)); !os.IsNotExist(err) {
+			t.Errorf("expected corrupt content to be removed; got %s", err)
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, _ := CreateCache(dir, 10)
+		cache.Put(digest.FromString("aaaa"), []byte("aaaa"))
+		cache.Put(digest.FromString("bbbb"), []byte("bbbb"))
+		cache.entries[digest.FromString("aaaa")].accessed = time.Now().Add(-time.Hour)
+		cache.Get(digest.FromString("bbbb"))
+		cache.Put(digest.FromString("cccc"), []byte("cccc"))
+		if _, ok := cache.Get(digest.FromString("aaaa")); ok {
+			t.Error("expected least recently used content to be evicted")
+		}
+		for _, content := range []string{"bbbb", "cccc"} {
+			if _, ok := cache.Get(digest.FromString(content)); !ok {
+				t.Errorf("expected %s to be cached", content)
+			}
+		}
+		if cache.size != 8 {
+			t.Errorf("expected size of 8; got %d", cache.size)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, _ := CreateCache(dir, 10)
+		cache.Put(digest.FromString("aaaa"), []byte("aaaa"))
+		err := cache.Put(digest.FromString("0123456789a"), []byte("0123456789a"))
+		if err == nil || !strings.Contains(err.Error(), "larger than the cache") {
+			t.Errorf("expected larger than the cache; got %v", err)
+		}
+		if _, ok := cache.Get(digest.FromString("aaaa")); !ok {
+			t.Error("expected the small content to stay cached")
+		}
+		if _, ok := cache.Get(digest.FromString("0123456789a")); ok || cache.size != 4 {
+			t.Errorf("expected the large content not to be cached; got size %d", cache.size)
+		}
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			if !file.IsDir() {
+				t.Errorf("expected temporary file to be removed; got %s", file.Name())
+			}
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, _ := CreateCache(dir, 0)
+		cache.Put(digest.FromString("hello"), []byte("hello"))
+		cache, err := CreateCache(dir, 0)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if content, ok := cache.Get(digest.FromString("hello")); !ok || string(content) != "hello" {
+			t.Errorf("expected hello; got %s", content)
+		}
+	})
+
+	t.Run("abandoned writer", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		cache, _ := CreateCache(dir, 0)
+		w, err := cache.Writer(digest.FromString("hello"))
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		w.Write([]byte("hel"))
+		w.Close()
+		if _, ok := cache.Get(digest.FromString("hello")); ok {
+			t.Error("expected cache miss")
+		}
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			if !file.IsDir() {
+				t.Errorf("expected temporary file to be removed; got %s", file.Name())
+			}
+		}
+	})
+}
@@ -0,0 +1,386 @@
+package client
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const dockerArchiveManifestFile = "manifest.json"
+
+// dockerArchiveEntry is an entry in the manifest.json of a docker save tarball.
+type dockerArchiveEntry struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// PushDockerArchive pushes an image from a docker save tarball to the registry URL, gzipping its layers and
+// generating a schema2 manifest for it. If the tarball holds more than one image, the one with a RepoTags entry
+// matching the URL's tag is pushed. Blobs that already exist in the target repository are not uploaded again.
+func (c *Client) PushDockerArchive(archive string, url string) error {
+	err := c.pushDockerArchive(archive, url)
+	if err != nil {
+		log.Println("failed to push docker archive", archive, url, err)
+	}
+	return err
+}
+
+func (c *Client) pushDockerArchive(archive string, url string) error {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return err
+	}
+	files, err := readArchiveFiles(archive, map[string]bool{dockerArchiveManifestFile: true})
+	if err != nil {
+		return err
+	}
+	var entries []dockerArchiveEntry
+	if err = json.Unmarshal(files[dockerArchiveManifestFile], &entries); err != nil {
+		return err
+	}
+	entry, err := selectArchiveEntry(entries, ref)
+	if err != nil {
+		return err
+	}
+	if files, err = readArchiveFiles(archive, map[string]bool{path.Clean(entry.Config): true}); err != nil {
+		return err
+	}
+	config := files[path.Clean(entry.Config)]
+	image := v1.Image{}
+	if err = json.Unmarshal(config, &image); err != nil {
+		return err
+	}
+	if len(image.RootFS.DiffIDs) != len(entry.Layers) {
+		return errors.New("image config has a different number of layers to manifest.json")
+	}
+	manifest := schema2.Manifest{Versioned: schema2.SchemaVersion}
+	for i, layer := range entry.Layers {
+		descriptor, err := c.pushArchiveLayer(ref, archive, path.Clean(layer), image.RootFS.DiffIDs[i])
+		if err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, descriptor)
+	}
+	if manifest.Config, err = c.PutBlob(ref, schema2.MediaTypeImageConfig, config); err != nil {
+		return err
+	}
+	dm, err := schema2.FromStruct(manifest)
+	if err != nil {
+		return err
+	}
+	_, payload, err := dm.Payload()
+	if err != nil {
+		return err
+	}
+	_, err = c.putManifest(url, Manifest{MediaType: schema2.MediaTypeManifest, Digest: digest.FromBytes(payload), Payload: payload})
+	return err
+}
+
+// selectArchiveEntry picks the only image in the tarball, or the one tagged with the reference's tag.
+func selectArchiveEntry(entries []dockerArchiveEntry, ref Reference) (dockerArchiveEntry, error) {
+	if len(entries) == 1 {
+		return entries[0], nil
+	}
+	for _, entry := range entries {
+		for _, repoTag := range entry.RepoTags {
+			if ref.Tag != "" && strings.HasSuffix(repoTag, ":"+ref.Tag) {
+				return entry, nil
+			}
+		}
+	}
+	return dockerArchiveEntry{}, errors.New("no image for " + ref.String() + " in docker archive")
+}
+
+// pushArchiveLayer gzips a layer of the tarball into a temporary file, checking it against its diff ID, and uploads it
+// from there unless it already exists. Layers are handled one at a time and never held in memory, as docker save
+// tarballs are often several gigabytes.
+func (c *Client) pushArchiveLayer(ref Reference, archive string, name string, diffID digest.Digest) (distribution.Descriptor, error) {
+	temp, err := ioutil.TempFile("", "layer")
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	var descriptor distribution.Descriptor
+	var layerDiffID digest.Digest
+	found := false
+	err = scanArchive(archive, map[string]bool{name: true}, func(_ string, content io.Reader) error {
+		var err error
+		found = true
+		descriptor, layerDiffID, err = compressLayer(content, temp)
+		return err
+	})
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if !found {
+		return distribution.Descriptor{}, errors.New("no " + name + " in docker archive")
+	}
+	if layerDiffID != diffID {
+		return distribution.Descriptor{}, errors.New("layer " + name + " does not match diff ID " + diffID.String())
+	}
+	exists, err := c.BlobExists(ref, descriptor.Digest)
+	if err != nil || exists {
+		return descriptor, err
+	}
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return descriptor, c.uploadBlob(ref, descriptor.Digest, descriptor.Size, temp)
+}
+
+// readArchiveFiles returns the content of the wanted files in the tarball, keyed by their cleaned names. It is meant
+// for small files such as manifest.json and image configs.
+func readArchiveFiles(archive string, wanted map[string]bool) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := scanArchive(archive, wanted, func(name string, content io.Reader) error {
+		var err error
+		files[name], err = ioutil.ReadAll(content)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name := range wanted {
+		if _, exists := files[name]; !exists {
+			return nil, errors.New("no " + name + " in docker archive")
+		}
+	}
+	return files, nil
+}
+
+// scanArchive calls fn with the content of each regular file in the tarball whose cleaned name is wanted.
+func scanArchive(archive string, wanted map[string]bool, fn func(name string, content io.Reader) error) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || !wanted[name] {
+			continue
+		}
+		if err = fn(name, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// compressLayer gzips an uncompressed layer tar into the file, returning the descriptor of the compressed layer and
+// the digest of the uncompressed content. Layers that are already gzipped are copied as they are.
+func compressLayer(layer io.Reader, file *os.File) (distribution.Descriptor, digest.Digest, error) {
+	buffered := bufio.NewReader(layer)
+	magic, _ := buffered.Peek(2)
+	digester := digest.Canonical.Digester()
+	compressed := io.MultiWriter(file, digester.Hash())
+	var diffID digest.Digest
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(io.TeeReader(buffered, compressed))
+		if err != nil {
+			return distribution.Descriptor{}, "", err
+		}
+		if diffID, err = digest.Canonical.FromReader(gz); err != nil {
+			return distribution.Descriptor{}, "", err
+		}
+		// the gzip reader may not have read to the end of the layer
+		if _, err = io.Copy(compressed, buffered); err != nil {
+			return distribution.Descriptor{}, "", err
+		}
+	} else {
+		diffIDDigester := digest.Canonical.Digester()
+		gz := gzip.NewWriter(compressed)
+		if _, err := io.Copy(io.MultiWriter(gz, diffIDDigester.Hash()), buffered); err != nil {
+			return distribution.Descriptor{}, "", err
+		}
+		if err := gz.Close(); err != nil {
+			return distribution.Descriptor{}, "", err
+		}
+		diffID = diffIDDigester.Digest()
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return distribution.Descriptor{}, "", err
+	}
+	return distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digester.Digest(), Size: size}, diffID, nil
+}
+
+// SaveDockerArchive writes the image at the registry URL to a tarball that docker load understands. For a
+// multi-platform image the platform, such as linux/amd64, must be given unless the image only has one platform.
+func (c *Client) SaveDockerArchive(url string, archive string, platform string) error {
+	err := c.saveDockerArchive(url, archive, platform)
+	if err != nil {
+		log.Println("failed to save docker archive", url, archive, err)
+	}
+	return err
+}
+
+func (c *Client) saveDockerArchive(url string, archive string, platform string) error {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return err
+	}
+	manifest, err := c.GetManifest(url)
+	if err != nil {
+		return err
+	}
+	if manifest.IsIndex() {
+		if manifest, err = c.selectPlatformManifest(ref, manifest, platform); err != nil {
+			return err
+		}
+	}
+	im, err := manifest.imageManifest()
+	if err != nil {
+		return err
+	}
+	config, err := c.getVerifiedBlob(ref, im.Config.Digest)
+	if err != nil {
+		return err
+	}
+	image := v1.Image{}
+	if err = json.Unmarshal(config, &image); err != nil {
+		return err
+	}
+	if len(image.RootFS.DiffIDs) != len(im.Layers) {
+		return errors.New("image config has a different number of layers to the manifest")
+	}
+	entry := dockerArchiveEntry{Config: im.Config.Digest.Hex() + ".json"}
+	repositories := make(map[string]map[string]string)
+	if ref.Tag != "" {
+		// docker load only treats Docker Hub images as such when they have their familiar names
+		entry.RepoTags = []string{ref.familiarName() + ":" + ref.Tag}
+	}
+	return writeFileAtomically(archive, func(w io.Writer) error {
+		tw := tar.NewWriter(w)
+		if err := writeTarFile(tw, entry.Config, bytes.NewReader(config), int64(len(config))); err != nil {
+			return err
+		}
+		for i, layer := range im.Layers {
+			name := image.RootFS.DiffIDs[i].Hex() + "/layer.tar"
+			if err := c.saveLayer(tw, ref, layer, image.RootFS.DiffIDs[i], name); err != nil {
+				return err
+			}
+			entry.Layers = append(entry.Layers, name)
+		}
+		if ref.Tag != "" && len(im.Layers) > 0 {
+			repositories[ref.familiarName()] = map[string]string{ref.Tag: image.RootFS.DiffIDs[len(im.Layers)-1].Hex()}
+		}
+		for _, file := range []struct {
+			name  string
+			value interface{}
+		}{{dockerArchiveManifestFile, []dockerArchiveEntry{entry}}, {"repositories", repositories}} {
+			content, err := json.Marshal(file.value)
+			if err != nil {
+				return err
+			}
+			if err = writeTarFile(tw, file.name, bytes.NewReader(content), int64(len(content))); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	})
+}
+
+// selectPlatformManifest returns the entry of the index for the platform, which may be empty if there is only one.
+func (c *Client) selectPlatformManifest(ref Reference, index Manifest, platform string) (Manifest, error) {
+	entries, err := index.indexManifests()
+	if err != nil {
+		return Manifest{}, err
+	}
+	for _, entry := range entries {
+		if platformString(entry.Platform) == platform || (platform == "" && len(entries) == 1) {
+			return c.GetManifest(ref.WithDigest(entry.Digest).ManifestURL())
+		}
+	}
+	if platform == "" {
+		return Manifest{}, errors.New(ref.String() + " is a multi-platform image - a platform must be given")
+	}
+	return Manifest{}, errors.New("no " + platform + " image in " + ref.String())
+}
+
+// saveLayer downloads and decompresses a layer into a temporary file, since the tar header needs its size, checks it
+// against the diff ID and then writes it to the tarball.
+func (c *Client) saveLayer(tw *tar.Writer, ref Reference, layer distribution.Descriptor, diffID digest.Digest, name string) error {
+	if err := layer.Digest.Validate(); err != nil {
+		return err
+	}
+	if err := diffID.Validate(); err != nil {
+		return err
+	}
+	compressed := false
+	switch layer.MediaType {
+	case v1.MediaTypeImageLayer, v1.MediaTypeImageLayerNonDistributable:
+	case schema2.MediaTypeLayer, schema2.MediaTypeForeignLayer, v1.MediaTypeImageLayerGzip, v1.MediaTypeImageLayerNonDistributableGzip:
+		compressed = true
+	default:
+		return errors.New("unsupported layer media type " + layer.MediaType + " - only gzipped and uncompressed layers can be saved")
+	}
+	reader, err := c.openBlob(ref.BlobURL(layer.Digest))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	verifier := layer.Digest.Verifier()
+	var uncompressed io.Reader = io.TeeReader(reader, verifier)
+	if compressed {
+		if uncompressed, err = gzip.NewReader(uncompressed); err != nil {
+			return err
+		}
+	}
+	temp, err := ioutil.TempFile("", "layer")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	diffIDVerifier := diffID.Verifier()
+	size, err := io.Copy(io.MultiWriter(temp, diffIDVerifier), uncompressed)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(ioutil.Discard, io.TeeReader(reader, verifier)); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return errors.New("blob digest mismatch - expected " + layer.Digest.String())
+	}
+	if !diffIDVerifier.Verified() {
+		return errors.New("layer " + layer.Digest.String() + " does not match diff ID " + diffID.String())
+	}
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeTarFile(tw, name, temp, size)
+}
+
+func writeTarFile(tw *tar.Writer, name string, content io.Reader, size int64) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, content)
+	return err
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+func writeTestArchive(t *testing.T, archive string, files map[string]string) {
+	var buffer bytes.Buffer
+	tw := tar.NewWriter(&buffer)
+	for name, content := range files {
+		if err := writeTarFile(tw, name, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal("failed to write tar", err)
+		}
+	}
+	tw.Close()
+	if err := ioutil.WriteFile(archive, buffer.Bytes(), 0644); err != nil {
+		t.Fatal("failed to write archive", err)
+	}
+}
+
+func TestPushDockerArchive(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	config := `{"os":"linux","architecture":"amd64","rootfs":{"type":"layers","diff_ids":["` + digest.FromString("layer").String() + `"]}}`
+	archive := filepath.Join(dir, "image.tar")
+	writeTestArchive(t, archive, map[string]string{
+		"manifest.json": `[{"Config":"config.json","RepoTags":["repo:v1"],"Layers":["abc/layer.tar"]},` +
+			`{"Config":"other.json","RepoTags":["repo:v2"],"Layers":[]}]`,
+		"config.json":   config,
+		"abc/layer.tar": "layer",
+	})
+
+	t.Run("no such tag", func(t *testing.T) {
+		client := Client{}
+		err := client.PushDockerArchive(archive, "http://hello/v2/repo/manifests/v3")
+		if err == nil || !strings.Contains(err.Error(), "no image for hello/repo:v3") {
+			t.Errorf("expected no image; got %s", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		client := Client{}
+		err := client.PushDockerArchive(archive, "http://hello/v2/repo/manifests/v2")
+		if err == nil || !strings.Contains(err.Error(), "no other.json in docker archive") {
+			t.Errorf("expected no other.json; got %s", err)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 202, Header: map[string][]string{"Location": {"/upload"}}},
+			http.Response{StatusCode: 201},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 201},
+		)}
+		err := client.PushDockerArchive(archive, "http://hello/v2/repo/manifests/v1")
+		if err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+	})
+
+	t.Run("streamed layers", func(t *testing.T) {
+		var gzipped bytes.Buffer
+		gz := gzip.NewWriter(&gzipped)
+		gz.Write([]byte("layer"))
+		gz.Close()
+		streamedConfig := `{"rootfs":{"type":"layers","diff_ids":["` + digest.FromString("layer").String() + `","` +
+			digest.FromString("layer").String() + `"]}}`
+		writeTestArchive(t, archive, map[string]string{
+			"manifest.json":    `[{"Config":"config.json","RepoTags":["repo:v1"],"Layers":["abc/layer.tar","def/layer.tar.gz"]}]`,
+			"config.json":      streamedConfig,
+			"abc/layer.tar":    "layer",
+			"def/layer.tar.gz": gzipped.String(),
+		})
+		mock := CreateScriptedHTTPClient(t,
+			Expectation{Method: "HEAD", Path: "/v2/repo/blobs/" + digest.FromString(streamedConfig).String()},
+			Expectation{Method: "HEAD", StatusCode: 404, Times: 2},
+			Expectation{Method: "POST", StatusCode: 202, ResponseHeader: http.Header{"Location": {"/upload"}}, Times: 2},
+			Expectation{Method: "PUT", Path: "/upload", StatusCode: 201, Times: 2},
+			Expectation{Method: "PUT", Path: "/v2/repo/manifests/v1", StatusCode: 201},
+		)
+		client := Client{client: mock}
+		if err := client.PushDockerArchive(archive, "http://hello/v2/repo/manifests/v1"); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		bodies := make(map[string][]string)
+		for _, request := range mock.Requests() {
+			if request.Method == "PUT" {
+				bodies[request.URL.Path] = append(bodies[request.URL.Path], string(request.Body))
+			}
+		}
+		if len(bodies["/upload"]) != 2 || len(bodies["/v2/repo/manifests/v1"]) != 1 {
+			t.Fatalf("expected two layers and a manifest to be pushed; got %q", bodies)
+		}
+		compressed := bodies["/upload"][0]
+		if uncompressed, err := gzip.NewReader(strings.NewReader(compressed)); err != nil {
+			t.Errorf("expected a gzipped layer; got %s", err)
+		} else if content, _ := ioutil.ReadAll(uncompressed); string(content) != "layer" {
+			t.Errorf("expected layer; got %s", content)
+		}
+		if bodies["/upload"][1] != gzipped.String() {
+			t.Errorf("expected the gzipped layer to be pushed as it is")
+		}
+		im := schema2.Manifest{}
+		if err := json.Unmarshal([]byte(bodies["/v2/repo/manifests/v1"][0]), &im); err != nil || len(im.Layers) != 2 {
+			t.Fatalf("expected a manifest with two layers; got %s and %v", bodies["/v2/repo/manifests/v1"], err)
+		}
+		if im.Layers[0].Digest != digest.FromString(compressed) || im.Layers[0].Size != int64(len(compressed)) {
+			t.Errorf("unexpected layer descriptor; got %+v", im.Layers[0])
+		}
+	})
+
+	t.Run("diff ID mismatch", func(t *testing.T) {
+		writeTestArchive(t, archive, map[string]string{
+			"manifest.json": `[{"Config":"config.json","RepoTags":["repo:v1"],"Layers":["abc/layer.tar"]}]`,
+			"config.json":   `{"rootfs":{"type":"layers","diff_ids":["` + digest.FromString("other").String() + `"]}}`,
+			"abc/layer.tar": "layer",
+		})
+		client := Client{}
+		err := client.PushDockerArchive(archive, "http://hello/v2/repo/manifests/v1")
+		if err == nil || !strings.Contains(err.Error(), "does not match diff ID") {
+			t.Errorf("expected does not match diff ID; got %v", err)
+		}
+	})
+}
+
+func TestSaveDockerArchive(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	var layer bytes.Buffer
+	gz := gzip.NewWriter(&layer)
+	gz.Write([]byte("layer"))
+	gz.Close()
+	config := `{"os":"linux","architecture":"amd64","rootfs":{"type":"layers","diff_ids":["` + digest.FromString("layer").String() + `"]}}`
+	m, _ := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString(config)},
+		Layers:    []distribution.Descriptor{{MediaType: schema2.MediaTypeLayer, Digest: digest.FromBytes(layer.Bytes())}},
+	})
+	_, manifest, _ := m.Payload()
+	archive := filepath.Join(dir, "image.tar")
+
+	client := Client{client: CreateMockHTTPClient(
+		manifestResponse(schema2.MediaTypeManifest, string(manifest)),
+		blobResponse(config),
+		blobResponse(layer.String()),
+	)}
+	err := client.SaveDockerArchive("http://hello/v2/repo/manifests/v1", archive, "")
+	if err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	layerName := digest.FromString("layer").Hex() + "/layer.tar"
+	files, err := readArchiveFiles(archive, map[string]bool{"manifest.json": true, "repositories": true, layerName: true})
+	if err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	if string(files[layerName]) != "layer" {
+		t.Errorf("expected uncompressed layer; got %s", files[layerName])
+	}
+	var entries []dockerArchiveEntry
+	json.Unmarshal(files["manifest.json"], &entries)
+	if len(entries) != 1 || entries[0].RepoTags[0] != "hello/repo:v1" || entries[0].Layers[0] != layerName {
+		t.Errorf("unexpected manifest.json; got %s", files["manifest.json"])
+	}
+}
+
+func TestSaveDockerArchiveLayerTypes(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	config := `{"os":"linux","architecture":"amd64","rootfs":{"type":"layers","diff_ids":["` + digest.FromString("layer").String() + `"]}}`
+	m, _ := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString(config)},
+		Layers:    []distribution.Descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar+zstd", Digest: digest.FromString("zstd")}},
+	})
+	_, manifest, _ := m.Payload()
+	client := Client{client: CreateMockHTTPClient(
+		manifestResponse(schema2.MediaTypeManifest, string(manifest)),
+		blobResponse(config),
+	)}
+	err := client.SaveDockerArchive("http://hello/v2/repo/manifests/v1", filepath.Join(dir, "image.tar"), "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported layer media type application/vnd.oci.image.layer.v1.tar+zstd") {
+		t.Errorf("expected unsupported layer media type; got %v", err)
+	}
+}
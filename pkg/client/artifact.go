@@ -0,0 +1,122 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Artifact is an OCI artifact, such as a test report or SBOM, to be pushed with PushArtifact.
+type Artifact struct {
+	ArtifactType string
+	Blobs        []ArtifactBlob
+	Subject      *v1.Descriptor
+	Annotations  map[string]string
+}
+
+// ArtifactBlob is a single blob of an Artifact.
+type ArtifactBlob struct {
+	MediaType   string
+	Content     []byte
+	Annotations map[string]string
+}
+
+// PushArtifact uploads the artifact's blobs to the repository of ref, then pushes an OCI image manifest for the
+// artifact to the tag of ref, or by digest if ref has no tag. It returns the descriptor of the pushed manifest.
+//
+// When the artifact has a subject and the registry doesn't acknowledge it with an OCI-Subject header, the registry
+// doesn't implement the referrers API, so the artifact is also added to the subject's referrers tag index.
+func (c *Client) PushArtifact(ref Reference, artifact Artifact) (v1.Descriptor, error) {
+	descriptor, err := c.pushArtifact(ref, artifact)
+	if err != nil {
+		log.Println("failed to push artifact", ref, err)
+	}
+	return descriptor, err
+}
+
+func (c *Client) pushArtifact(ref Reference, artifact Artifact) (v1.Descriptor, error) {
+	if artifact.ArtifactType == "" {
+		return v1.Descriptor{}, errors.New("artifact has no artifactType")
+	}
+	empty := v1.DescriptorEmptyJSON
+	empty.Data = nil
+	if _, err := c.PutBlob(ref, empty.MediaType, []byte("{}")); err != nil {
+		return v1.Descriptor{}, err
+	}
+	manifest := v1.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    v1.MediaTypeImageManifest,
+		ArtifactType: artifact.ArtifactType,
+		Config:       empty,
+		Subject:      artifact.Subject,
+		Annotations:  artifact.Annotations,
+	}
+	for _, blob := range artifact.Blobs {
+		layer, err := c.PutBlob(ref, blob.MediaType, blob.Content)
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		manifest.Layers = append(manifest.Layers, v1.Descriptor{
+			MediaType:   layer.MediaType,
+			Digest:      layer.Digest,
+			Size:        layer.Size,
+			Annotations: blob.Annotations,
+		})
+	}
+	if len(manifest.Layers) == 0 {
+		manifest.Layers = []v1.Descriptor{empty}
+	}
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	descriptor := v1.Descriptor{
+		MediaType:    v1.MediaTypeImageManifest,
+		ArtifactType: artifact.ArtifactType,
+		Digest:       digest.FromBytes(payload),
+		Size:         int64(len(payload)),
+		Annotations:  artifact.Annotations,
+	}
+	target := ref
+	if ref.Tag == "" {
+		target = ref.WithDigest(descriptor.Digest)
+	}
+	response, err := c.putManifest(target.ManifestURL(), Manifest{MediaType: v1.MediaTypeImageManifest, Digest: descriptor.Digest, Payload: payload})
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if artifact.Subject != nil && response.Header.Get("OCI-Subject") == "" {
+		err = c.addToReferrersTag(ref, artifact.Subject.Digest, descriptor)
+	}
+	return descriptor, err
+}
+
+// addToReferrersTag adds the descriptor to the subject's fallback referrers index, creating it if necessary.
+func (c *Client) addToReferrersTag(repo Reference, subject digest.Digest, descriptor v1.Descriptor) error {
+	index, err := c.getReferrersTagIndex(repo, subject)
+	if err != nil {
+		return err
+	}
+	for _, existing := range index.Manifests {
+		if existing.Digest == descriptor.Digest {
+			return nil
+		}
+	}
+	index.SchemaVersion = 2
+	index.MediaType = v1.MediaTypeImageIndex
+	index.Manifests = append(index.Manifests, descriptor)
+	payload, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	_, err = c.putManifest(repo.WithTag(referrersTag(subject)).ManifestURL(), Manifest{
+		MediaType: v1.MediaTypeImageIndex,
+		Digest:    digest.FromBytes(payload),
+		Payload:   payload,
+	})
+	return err
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPushArtifact(t *testing.T) {
+	repo, _ := ParseReference("http://hello/v2/repo/manifests/latest")
+	repo = repo.WithTag("")
+	subject := &v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("subject"), Size: 7}
+	artifact := Artifact{
+		ArtifactType: "application/vnd.example.sbom",
+		Blobs:        []ArtifactBlob{{MediaType: "application/json", Content: []byte(`{"sbom":true}`)}},
+		Subject:      subject,
+		Annotations:  map[string]string{"org.opencontainers.image.created": "2020-01-01T00:00:00Z"},
+	}
+
+	t.Run("no artifact type", func(t *testing.T) {
+		client := Client{}
+		_, err := client.PushArtifact(repo, Artifact{})
+		if err == nil || !strings.Contains(err.Error(), "no artifactType") {
+			t.Errorf("expected no artifactType; got %s", err)
+		}
+	})
+
+	t.Run("registry supports subject", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 201, Header: map[string][]string{"Oci-Subject": {subject.Digest.String()}}},
+		)}
+		descriptor, err := client.PushArtifact(repo, artifact)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if descriptor.ArtifactType != artifact.ArtifactType || descriptor.MediaType != v1.MediaTypeImageManifest || descriptor.Size == 0 {
+			t.Errorf("unexpected descriptor; got %+v", descriptor)
+		}
+	})
+
+	t.Run("referrers tag fallback", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 201},
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 201},
+		)}
+		_, err := client.PushArtifact(repo, artifact)
+		if err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+	})
+
+	t.Run("referrers tag error", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 201},
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 500},
+		)}
+		_, err := client.PushArtifact(repo, artifact)
+		if err == nil || !strings.Contains(err.Error(), "status code 500") {
+			t.Errorf("expected status code 500; got %s", err)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"net/http"
+)
+
+// CredentialsRequiredError is returned when the registry asks for credentials and either none are configured for the
+// host or the ones configured are rejected.
+type CredentialsRequiredError struct {
+	Host     string
+	Scheme   string
+	Rejected bool
+}
+
+func (e CredentialsRequiredError) Error() string {
+	if e.Rejected {
+		return "credentials rejected - " + e.Host + " refused the configured credentials for " + e.Scheme + " auth"
+	}
+	return "credentials required - " + e.Host + " asks for " + e.Scheme + " auth but no credentials are configured"
+}
+
+// IsCredentialsRequired reports whether the error is a CredentialsRequiredError.
+func IsCredentialsRequired(err error) bool {
+	_, ok := err.(CredentialsRequiredError)
+	return ok
+}
+
+// authenticate retries a request the registry responded to with a 401, using the scheme it challenged with.
+//
+// A Bearer challenge is answered with a token from the realm, fetched with the basic credentials configured for the
+// host, or anonymously if there are none. The token is only asked for the scopes the request needs, so that a long
+// session across many repositories doesn't ask for ever more scopes, and it replaces the host's cached token, recorded
+// with the scopes its access claim grants. A Basic challenge is answered with the basic credentials, unless the request
+// already carried them. Bearer is preferred when the registry offers both.
+func (c *Client) authenticate(request *http.Request, body string, response *http.Response, basicAuth string, scopes []string) (*http.Response, error) {
+	if response.Body != nil {
+		response.Body.Close()
+	}
+	credentialsRequired := CredentialsRequiredError{Host: request.Host, Scheme: "Bearer", Rejected: basicAuth != ""}
+	challenges := getChallenges(response)
+	_, bearer := findChallenge(challenges, "bearer")
+	_, basic := findChallenge(challenges, "basic")
+	var auth string
+	if basic && !bearer {
+		credentialsRequired.Scheme = "Basic"
+		if basicAuth == "" || request.Header.Get("Authorization") == basicAuth {
+			return nil, credentialsRequired
+		}
+		auth = basicAuth
+	} else {
+		token, err := c.getDockerBearerAuth(response, basicAuth, scopes...)
+		if statusErr, ok := err.(StatusError); ok && statusErr.StatusCode == 401 {
+			return nil, credentialsRequired
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.tokens.put(request.Host, basicAuth, token)
+		auth = token.auth
+	}
+	setHeader(request, "Authorization", auth)
+	setBody(request, body)
+	if body == "" && request.GetBody != nil {
+		var err error
+		if request.Body, err = request.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == 401 {
+		if response.Body != nil {
+			response.Body.Close()
+		}
+		return nil, credentialsRequired
+	}
+	if !isSuccess(response.StatusCode) {
+		closeResponse(response)
+		return nil, StatusError{StatusCode: response.StatusCode, message: "failed to get a good response with " + credentialsRequired.Scheme + " auth - status code is "}
+	}
+	return response, nil
+}
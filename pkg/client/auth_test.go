@@ -0,0 +1,123 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/vleurgat/dockerclient/pkg/registrytest"
+)
+
+func TestAuthenticate(t *testing.T) {
+	payload := `{"schemaVersion":2,"mediaType":"` + v1.MediaTypeImageManifest + `","config":{},"layers":[]}`
+	registry := registrytest.CreateRegistry()
+	defer registry.Close()
+	registry.PutManifest("app", "v1", v1.MediaTypeImageManifest, []byte(payload))
+	url := registry.ManifestURL("app", "v1")
+	createClient := func(username string, password string) Client {
+		config := &configfile.ConfigFile{AuthConfigs: map[string]types.AuthConfig{}}
+		if username != "" {
+			config.AuthConfigs[registry.Host()] = types.AuthConfig{Username: username, Password: password}
+		}
+		return CreateClientProvidingHTTPClient(HTTPClientImpl{realHTTPClient: http.DefaultClient}, config)
+	}
+
+	for name, test := range map[string]struct {
+		setup    func()
+		username string
+		password string
+		expected string
+	}{
+		"basic":                      {func() { registry.SetBasicAuth("user", "pass") }, "user", "pass", ""},
+		"basic without credentials":  {func() { registry.SetBasicAuth("user", "pass") }, "", "", "credentials required - "},
+		"basic with bad credentials": {func() { registry.SetBasicAuth("user", "pass") }, "user", "oops", "credentials rejected - "},
+		"token":                      {func() { registry.SetTokenAuth("user", "pass") }, "user", "pass", ""},
+		"anonymous token":            {func() { registry.SetTokenAuth("", "") }, "", "", ""},
+		"token without credentials":  {func() { registry.SetTokenAuth("user", "pass") }, "", "", "credentials required - "},
+		"token with bad credentials": {func() { registry.SetTokenAuth("user", "pass") }, "user", "oops", "credentials rejected - "},
+	} {
+		t.Run(name, func(t *testing.T) {
+			test.setup()
+			client := createClient(test.username, test.password)
+			_, err := client.GetManifest(url)
+			if test.expected == "" {
+				if err != nil {
+					t.Errorf("expected nil error; got %s", err)
+				}
+				return
+			}
+			if !IsCredentialsRequired(err) || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected %s; got %v", test.expected, err)
+			}
+		})
+	}
+
+	t.Run("basic retry", func(t *testing.T) {
+		basicAuth := "Basic " + base64Encode("user", "pass")
+		mock := CreateScriptedHTTPClient(t, Expectation{Method: "GET", Header: http.Header{"Authorization": {basicAuth}}, Body: "{}"})
+		client := Client{client: mock}
+		request, _ := http.NewRequest("GET", "http://my.host/v2/", nil)
+		request.Header.Set("Authorization", "Bearer stale")
+		challenge := &http.Response{StatusCode: 401, Header: http.Header{"Www-Authenticate": {`Basic realm="registry"`}}}
+		if response, err := client.authenticate(request, "", challenge, basicAuth, nil); err != nil || response.StatusCode != 200 {
+			t.Errorf("expected a retry with basic auth; got %v and %v", response, err)
+		}
+	})
+}
+
+func TestTokenReuse(t *testing.T) {
+	payload := `{"schemaVersion":2,"mediaType":"` + v1.MediaTypeImageManifest + `","config":{},"layers":[]}`
+	registry := registrytest.CreateRegistry()
+	defer registry.Close()
+	registry.SetTokenAuth("", "")
+	registry.PutManifest("app", "v1", v1.MediaTypeImageManifest, []byte(payload))
+	client := CreateClientProvidingHTTPClient(HTTPClientImpl{realHTTPClient: http.DefaultClient}, nil)
+	countTokens := func() int {
+		count := 0
+		for _, request := range registry.Requests() {
+			if strings.HasPrefix(request, "GET /token") {
+				count++
+			}
+		}
+		return count
+	}
+
+	for _, step := range []struct {
+		name     string
+		run      func() error
+		expected int
+	}{
+		{"pull", func() error { _, err := client.GetManifest(registry.ManifestURL("app", "v1")); return err }, 1},
+		{"pull again", func() error { _, err := client.HeadManifest(registry.ManifestURL("app", "v1")); return err }, 1},
+		{"push", func() error {
+			return client.PutManifest(registry.ManifestURL("app", "v2"), Manifest{MediaType: v1.MediaTypeImageManifest, Payload: []byte(payload)})
+		}, 2},
+		{"pull after push", func() error { _, err := client.GetManifest(registry.ManifestURL("app", "v2")); return err }, 2},
+	} {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: expected nil error; got %s", step.name, err)
+		}
+		if count := countTokens(); count != step.expected {
+			t.Errorf("%s: expected %d tokens; got %d", step.name, step.expected, count)
+		}
+	}
+	registry.PutManifest("other", "v1", v1.MediaTypeImageManifest, []byte(payload))
+	if _, err := client.GetManifest(registry.ManifestURL("other", "v1")); err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	requests := registry.Requests()
+	var scopes []string
+	for _, request := range requests {
+		if strings.HasPrefix(request, "GET /token?") {
+			query, _ := url.ParseQuery(strings.Fields(strings.TrimPrefix(request, "GET /token?"))[0])
+			scopes = query["scope"]
+		}
+	}
+	if len(scopes) != 1 || scopes[0] != "repository:other:pull" {
+		t.Errorf("expected the token for another repository to only ask for its scope; got %s", scopes)
+	}
+}
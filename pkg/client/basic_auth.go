@@ -1,23 +1,47 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"log"
+	"strings"
 )
 
-func (c *Client) getDockerBasicAuth(host string) string {
-	basicAuth := ""
-	if c.dockerConfig != nil {
-		config, exists := c.dockerConfig.AuthConfigs[host]
-		if exists {
-			if config.Auth != "" {
-				basicAuth = "Basic " + config.Auth
-			} else if config.Username != "" && config.Password != "" {
-				basicAuth = "Basic " + base64Encode(config.Username, config.Password)
-			}
+// getDockerBasicAuth returns the basic Authorization header value for the repository on the host, from the Client's
+// credential provider or, failing that, its Docker config. Credentials for the repository's namespaces are looked for
+// before those for the host, so for quay.io and org/team/app the keys are quay.io/org/team/app, quay.io/org/team,
+// quay.io/org and quay.io, and the most specific one with credentials wins.
+func (c *Client) getDockerBasicAuth(host string, repository string) string {
+	var provider CredentialProvider = CreateDockerConfigProvider(c.dockerConfig)
+	if c.credentials != nil {
+		provider = c.credentials
+	}
+	for _, key := range credentialKeys(host, repository) {
+		credential, err := provider.Credentials(context.Background(), key)
+		if err != nil {
+			log.Println("failed to get credentials", key, err)
+			return ""
+		}
+		if !credential.IsEmpty() {
+			return credential.basicAuth()
+		}
+	}
+	return ""
+}
+
+// credentialKeys returns the keys to look for credentials under, most specific first.
+func credentialKeys(host string, repository string) []string {
+	keys := []string{host}
+	key := host
+	for _, component := range strings.Split(repository, "/") {
+		if component == "" {
+			break
 		}
+		key += "/" + component
+		keys = append([]string{key}, keys...)
 	}
-	return basicAuth
+	return keys
 }
 
 func base64Encode(username string, password string) string {
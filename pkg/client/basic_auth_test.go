@@ -16,14 +16,14 @@ func TestGetDockerBasicAuth(t *testing.T) {
 
 	t.Run("no auth", func(t *testing.T) {
 		client = Client{client: nil, dockerConfig: nil}
-		auth := client.getDockerBasicAuth("my.host")
+		auth := client.getDockerBasicAuth("my.host", "")
 		if auth != "" {
 			t.Errorf("expected empty auth string; got %s", auth)
 		}
 	})
 
 	t.Run("no match", func(t *testing.T) {
-		auth := client.getDockerBasicAuth("my.host")
+		auth := client.getDockerBasicAuth("my.host", "")
 		if auth != "" {
 			t.Errorf("expected empty auth string; got %s", auth)
 		}
@@ -36,9 +36,46 @@ func TestGetDockerBasicAuth(t *testing.T) {
 			t.Error("failed to read JSON", err)
 		}
 		client.dockerConfig = configFile
-		auth := client.getDockerBasicAuth("my.host")
+		auth := client.getDockerBasicAuth("my.host", "")
 		if auth != "Basic token" {
 			t.Errorf("expected 'Basic token'; got %s", auth)
 		}
 	})
+
+	t.Run("provider", func(t *testing.T) {
+		client.SetCredentialProvider(StaticProvider{"my.host": {Username: "me", Password: "secret"}})
+		auth := client.getDockerBasicAuth("my.host", "")
+		if auth != "Basic "+base64Encode("me", "secret") {
+			t.Errorf("expected me:secret; got %s", auth)
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		client.SetCredentialProvider(failingProvider{})
+		auth := client.getDockerBasicAuth("my.host", "")
+		if auth != "" {
+			t.Errorf("expected empty auth string; got %s", auth)
+		}
+	})
+
+	t.Run("namespaces", func(t *testing.T) {
+		client.SetCredentialProvider(StaticProvider{
+			"quay.io":          {Auth: "host"},
+			"quay.io/org":      {Auth: "org"},
+			"quay.io/org/team": {Auth: "team"},
+		})
+		for repository, expected := range map[string]string{
+			"":             "Basic host",
+			"other/app":    "Basic host",
+			"org/app":      "Basic org",
+			"org/team/app": "Basic team",
+			"org/teamwork": "Basic org",
+			"org/team/a/b": "Basic team",
+			"organisation": "Basic host",
+		} {
+			if auth := client.getDockerBasicAuth("quay.io", repository); auth != expected {
+				t.Errorf("%s: expected %s; got %s", repository, expected, auth)
+			}
+		}
+	})
 }
@@ -5,77 +5,132 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
-	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-func parseBearer(bearer string) map[string]string {
-	kv := make(map[string]string)
-	// we're processing a suffix like: foo="hello,world",bar="abc",goo="anything"
-	// which should result in the map: {foo:hello,world bar:abc goo:anything}
-	rx := regexp.MustCompile("[a-zA-Z0-9]+=\"[^\"]+\"")
-	tokens := rx.FindAllString(bearer, -1)
-	for _, token := range tokens {
-		token = strings.Trim(token, " ")
-		if parts := strings.SplitN(token, "=", 2); len(parts) == 2 {
-			kv[parts[0]] = strings.Trim(parts[1], `"`)
-		} else {
-			kv[token] = ""
-		}
-	}
-	return kv
+// defaultTokenExpiry is how long a token lasts when the token server doesn't say, as per the distribution token spec.
+const defaultTokenExpiry = 60 * time.Second
+
+// bearerToken is a token issued by a registry's token server, along with the scopes it grants.
+type bearerToken struct {
+	auth    string
+	scopes  []string
+	expires time.Time
+}
+
+// tokenCache remembers the last token issued for each registry host and credential, so that it can be sent up front
+// rather than waiting to be challenged. Keeping tokens per credential stops a token fetched with the credentials for
+// one namespace being used for another.
+type tokenCache struct {
+	mutex  sync.Mutex
+	tokens map[string]bearerToken
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: make(map[string]bearerToken)}
+}
+
+// get returns the unexpired token for the host and basic credentials, if there is one.
+func (t *tokenCache) get(host string, basicAuth string) (bearerToken, bool) {
+	if t == nil {
+		return bearerToken{}, false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	token, exists := t.tokens[host+" "+basicAuth]
+	if !exists || time.Now().After(token.expires) {
+		return bearerToken{}, false
+	}
+	return token, true
+}
+
+func (t *tokenCache) put(host string, basicAuth string, token bearerToken) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tokens[host+" "+basicAuth] = token
 }
 
-func getBearerAuthURL(response *http.Response) (string, error) {
-	header := response.Header.Get("Www-Authenticate")
-	if !strings.HasPrefix(header, "Bearer ") {
+// getBearerAuthURL returns the URL to fetch a token from for the bearer challenge in the response, asking for the
+// scope in the challenge along with any others given.
+func getBearerAuthURL(response *http.Response, scopes ...string) (string, error) {
+	bearer, exists := findChallenge(getChallenges(response), "bearer")
+	if !exists {
 		return "", errors.New("no bearer Www-Authenticate header")
 	}
-	bearer := header[7:]
-	bearerKv := parseBearer(bearer)
-	bearerURL, err := url.Parse(bearerKv["realm"])
+	bearerURL, err := url.Parse(bearer.parameters["realm"])
 	if err != nil {
 		return "", err
 	}
-	bearerURL.RawQuery = url.Values{
-		"service": []string{bearerKv["service"]},
-		"scope":   []string{bearerKv["scope"]},
-	}.Encode()
+	query := bearerURL.Query()
+	query.Set("service", bearer.parameters["service"])
+	query.Del("scope")
+	for _, scope := range mergeScopes(append(strings.Fields(bearer.parameters["scope"]), scopes...)) {
+		query.Add("scope", scope)
+	}
+	bearerURL.RawQuery = query.Encode()
 	return bearerURL.String(), nil
 }
 
-func extractBearerToken(response *http.Response) (string, error) {
+func extractBearerToken(response *http.Response) (bearerToken, error) {
 	defer response.Body.Close()
 	type tokenResponse struct {
 		Token       string `json:"token"`
 		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		IssuedAt    string `json:"issued_at"`
 	}
 	tr := new(tokenResponse)
 	err := json.NewDecoder(response.Body).Decode(tr)
 	if err != nil {
-		return "", err
+		return bearerToken{}, err
+	}
+	if tr.Token == "" {
+		tr.Token = tr.AccessToken
+	}
+	issued, err := time.Parse(time.RFC3339, tr.IssuedAt)
+	if err != nil {
+		issued = time.Now()
+	}
+	expiry := defaultTokenExpiry
+	if tr.ExpiresIn > 0 {
+		expiry = time.Duration(tr.ExpiresIn) * time.Second
 	}
-	return "Bearer " + tr.Token, nil
+	scopes, known := accessClaimScopes(tr.Token)
+	if known && scopes == nil {
+		// an empty access claim grants nothing, which is not the same as not saying what it grants
+		scopes = []string{}
+	}
+	return bearerToken{auth: "Bearer " + tr.Token, scopes: scopes, expires: issued.Add(expiry)}, nil
 }
 
-func (c *Client) getDockerBearerAuth(response *http.Response, basicAuth string) (string, error) {
-	bearerURL, err := getBearerAuthURL(response)
+// getDockerBearerAuth fetches a token for the bearer challenge in the response. The token's scopes are taken from its
+// access claim, or assumed to be the ones asked for if it doesn't have one. An empty access claim grants nothing.
+func (c *Client) getDockerBearerAuth(response *http.Response, basicAuth string, scopes ...string) (bearerToken, error) {
+	bearerURL, err := getBearerAuthURL(response, scopes...)
 	if err != nil {
-		return "", err
+		return bearerToken{}, err
 	}
 	req, err := http.NewRequest("GET", bearerURL, nil)
 	if err != nil {
-		return "", err
+		return bearerToken{}, err
 	}
 	setHeader(req, "Authorization", basicAuth)
 	setHeader(req, "Accept", "application/json")
 	response, err = c.client.Do(req)
 	if err != nil {
-		return "", err
+		return bearerToken{}, err
 	}
 	if response.StatusCode != 200 {
-		return "", errors.New("failed to determine the bearer token - status code is " + strconv.Itoa(response.StatusCode))
+		return bearerToken{}, StatusError{StatusCode: response.StatusCode, message: "failed to determine the bearer token - status code is "}
+	}
+	token, err := extractBearerToken(response)
+	if err == nil && token.scopes == nil {
+		token.scopes = req.URL.Query()["scope"]
 	}
-	return extractBearerToken(response)
+	return token, err
 }
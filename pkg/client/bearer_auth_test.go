@@ -1,9 +1,11 @@
 package client
 
 import (
+	"encoding/base64"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"errors"
 	"io/ioutil"
@@ -11,45 +13,12 @@ import (
 	"github.com/docker/cli/cli/config/configfile"
 )
 
-func TestParseBearer(t *testing.T) {
-	t.Run("no match", func(t *testing.T) {
-		kv := parseBearer("hello")
-		if len(kv) != 0 {
-			t.Errorf("expected no match; got %s", kv)
-		}
-	})
-	t.Run("no commas", func(t *testing.T) {
-		kv := parseBearer("one=\"hello\"")
-		if len(kv) != 1 || kv["one"] != "hello" {
-			t.Errorf("expected map of one to hello; got %s", kv)
-		}
-	})
-	t.Run("three entries", func(t *testing.T) {
-		kv := parseBearer("one=\"aaa\",two=\"bbb\",three=\"ccc\"")
-		if len(kv) != 3 {
-			t.Errorf("expected map with three keys; got %s", kv)
-		}
-		if kv["one"] != "aaa" || kv["two"] != "bbb" || kv["three"] != "ccc" {
-			t.Errorf("expected keys to map to strings; got %s", kv)
-		}
-	})
-	t.Run("two entries with commas", func(t *testing.T) {
-		kv := parseBearer("t1=\"hello,there\" , t2=\"goodbye,again\"")
-		if len(kv) != 2 {
-			t.Errorf("expected map with two keys; got %s", kv)
-		}
-		if kv["t1"] != "hello,there" || kv["t2"] != "goodbye,again" {
-			t.Errorf("expected t1:hello,there and t2:goodbye,again; got %s", kv)
-		}
-	})
-}
-
-func TestGetBrearerAuthURL(t *testing.T) {
+func TestGetBearerAuthURL(t *testing.T) {
 	t.Run("no header", func(t *testing.T) {
 		response := &http.Response{
 			Header: map[string][]string{},
 		}
-		url, err := getBrearerAuthURL(response)
+		url, err := getBearerAuthURL(response)
 		if url != "" || err == nil {
 			t.Fatalf("expected empty url and non nil error; got url %s", url)
 		}
@@ -65,7 +34,7 @@ func TestGetBrearerAuthURL(t *testing.T) {
 				},
 			},
 		}
-		url, err := getBrearerAuthURL(response)
+		url, err := getBearerAuthURL(response)
 		if url != "" || err == nil {
 			t.Fatalf("expected empty url and non nil error; got url %s", url)
 		}
@@ -81,7 +50,7 @@ func TestGetBrearerAuthURL(t *testing.T) {
 				},
 			},
 		}
-		url, err := getBrearerAuthURL(response)
+		url, err := getBearerAuthURL(response)
 		if err != nil {
 			t.Fatalf("expected nil error; got %s", err)
 		}
@@ -89,6 +58,39 @@ func TestGetBrearerAuthURL(t *testing.T) {
 			t.Errorf("unexpected url; got %s", url)
 		}
 	})
+	t.Run("basic and bearer headers", func(t *testing.T) {
+		response := &http.Response{
+			Header: map[string][]string{
+				"Www-Authenticate": {
+					`Basic realm="registry"`,
+					`BEARER Realm="http://boo?x=1",Service="svc"`,
+				},
+			},
+		}
+		url, err := getBearerAuthURL(response)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if url != "http://boo?service=svc&x=1" {
+			t.Errorf("unexpected url; got %s", url)
+		}
+	})
+	t.Run("several scopes", func(t *testing.T) {
+		response := &http.Response{
+			Header: map[string][]string{
+				"Www-Authenticate": {
+					`Bearer realm="http://boo",service="svc",scope="repository:a:pull"`,
+				},
+			},
+		}
+		url, err := getBearerAuthURL(response, "repository:a:pull,push", "repository:b:pull")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if url != "http://boo?scope=repository%3Aa%3Apull%2Cpush&scope=repository%3Ab%3Apull&service=svc" {
+			t.Errorf("unexpected url; got %s", url)
+		}
+	})
 }
 
 func TestExtractBearerToken(t *testing.T) {
@@ -97,8 +99,8 @@ func TestExtractBearerToken(t *testing.T) {
 			Body: ioutil.NopCloser(strings.NewReader("rubbish")),
 		}
 		token, err := extractBearerToken(response)
-		if token != "" || err == nil {
-			t.Fatalf("expected empty token and non nil error; got token %s", token)
+		if token.auth != "" || err == nil {
+			t.Fatalf("expected empty token and non nil error; got token %s", token.auth)
 		}
 		if !strings.Contains(err.Error(), "invalid character") {
 			t.Errorf("expected invalid character; got %s", err)
@@ -112,9 +114,42 @@ func TestExtractBearerToken(t *testing.T) {
 		if err != nil {
 			t.Fatalf("expected nil error; got err %s", err)
 		}
-		if token != "Bearer my-token" {
+		if token.auth != "Bearer my-token" {
 			t.Errorf("unexpected token; got %s", err)
 		}
+		if until := time.Until(token.expires); until <= 0 || until > defaultTokenExpiry {
+			t.Errorf("expected the default expiry; got %s", token.expires)
+		}
+	})
+	t.Run("access token", func(t *testing.T) {
+		claims := base64.RawURLEncoding.EncodeToString([]byte(`{"access":[{"type":"repository","name":"a","actions":["pull","push"]}]}`))
+		jwt := "header." + claims + ".signature"
+		response := &http.Response{
+			Body: ioutil.NopCloser(strings.NewReader(`{"access_token":"` + jwt + `","expires_in":300,"issued_at":"2020-01-02T03:04:05Z"}`)),
+		}
+		token, err := extractBearerToken(response)
+		if err != nil {
+			t.Fatalf("expected nil error; got err %s", err)
+		}
+		if token.auth != "Bearer "+jwt || !token.expires.Equal(time.Date(2020, 1, 2, 3, 9, 5, 0, time.UTC)) {
+			t.Errorf("unexpected token; got %+v", token)
+		}
+		if len(token.scopes) != 1 || token.scopes[0] != "repository:a:pull,push" {
+			t.Errorf("expected the access claim scopes; got %s", token.scopes)
+		}
+	})
+	t.Run("empty access claim", func(t *testing.T) {
+		jwt := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"access":null}`)) + ".signature"
+		response := &http.Response{
+			Body: ioutil.NopCloser(strings.NewReader(`{"token":"` + jwt + `"}`)),
+		}
+		token, err := extractBearerToken(response)
+		if err != nil {
+			t.Fatalf("expected nil error; got err %s", err)
+		}
+		if token.scopes == nil || coversScopes(token.scopes, []string{"repository:a:pull"}) {
+			t.Errorf("expected the token to grant nothing; got %#v", token.scopes)
+		}
 	})
 }
 
@@ -125,8 +160,8 @@ func TestGetDockerBearerAuth(t *testing.T) {
 	t.Run("no bearer auth url", func(t *testing.T) {
 		res := &http.Response{}
 		auth, err := client.getDockerBearerAuth(res, "")
-		if auth != "" || err == nil {
-			t.Fatalf("expected empty auth and non nil error; got auth %s", auth)
+		if auth.auth != "" || err == nil {
+			t.Fatalf("expected empty auth and non nil error; got auth %s", auth.auth)
 		}
 		if !strings.Contains(err.Error(), "no bearer Www-Authenticate header") {
 			t.Errorf("expected no bearer Www-Authenticate header; got %s", err)
@@ -142,8 +177,8 @@ func TestGetDockerBearerAuth(t *testing.T) {
 			},
 		}
 		auth, err := client.getDockerBearerAuth(res, "")
-		if auth != "" || err == nil {
-			t.Fatalf("expected empty auth and non nil error; got auth %s", auth)
+		if auth.auth != "" || err == nil {
+			t.Fatalf("expected empty auth and non nil error; got auth %s", auth.auth)
 		}
 		if !strings.Contains(err.Error(), "missing protocol") {
 			t.Errorf("expected missing protocol; got %s", err)
@@ -161,8 +196,8 @@ func TestGetDockerBearerAuth(t *testing.T) {
 			},
 		}
 		auth, err := client.getDockerBearerAuth(res, "")
-		if auth != "" || err == nil {
-			t.Fatalf("expected empty auth and non nil error; got auth %s", auth)
+		if auth.auth != "" || err == nil {
+			t.Fatalf("expected empty auth and non nil error; got auth %s", auth.auth)
 		}
 		if !strings.Contains(err.Error(), "oops") {
 			t.Errorf("expected oops; got %s", err)
@@ -180,8 +215,8 @@ func TestGetDockerBearerAuth(t *testing.T) {
 			},
 		}
 		auth, err := client.getDockerBearerAuth(res, "")
-		if auth != "" || err == nil {
-			t.Fatalf("expected empty auth and non nil error; got auth %s", auth)
+		if auth.auth != "" || err == nil {
+			t.Fatalf("expected empty auth and non nil error; got auth %s", auth.auth)
 		}
 		if !strings.Contains(err.Error(), "status code is 500") {
 			t.Errorf("expected status code is 500; got %s", err)
@@ -202,8 +237,8 @@ func TestGetDockerBearerAuth(t *testing.T) {
 			},
 		}
 		auth, err := client.getDockerBearerAuth(res, "")
-		if auth != "Bearer my-token" || err != nil {
-			t.Fatalf("expected good auth and nil error; got auth %s; got err %s", auth, err)
+		if auth.auth != "Bearer my-token" || err != nil {
+			t.Fatalf("expected good auth and nil error; got auth %s; got err %s", auth.auth, err)
 		}
 	})
 }
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+// GetBlob returns the content of the blob at the provided registry URL.
+func (c *Client) GetBlob(url string) ([]byte, error) {
+	reader, err := c.openBlob(url)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// openBlob returns a reader for the blob at the registry URL, served from the cache if the Client has one.
+func (c *Client) openBlob(url string) (io.ReadCloser, error) {
+	d := blobURLDigest(url)
+	if c.cache != nil && d != "" {
+		if reader, ok := c.cache.Open(d); ok {
+			return reader, nil
+		}
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.do(request, "")
+	if err != nil {
+		log.Println("failed to GET blob", url, err)
+		return nil, err
+	}
+	if c.cache != nil && d != "" {
+		if writer, err := c.cache.Writer(d); err == nil {
+			return &cachingReader{ReadCloser: response.Body, writer: writer}, nil
+		}
+	}
+	return response.Body, nil
+}
+
+// getVerifiedBlob fetches a blob from the repository of ref, checking its content against the digest.
+func (c *Client) getVerifiedBlob(ref Reference, d digest.Digest) ([]byte, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	blob, err := c.GetBlob(ref.BlobURL(d))
+	if err != nil {
+		return nil, err
+	}
+	if d.Algorithm().FromBytes(blob) != d {
+		return nil, errors.New("blob digest mismatch - expected " + d.String())
+	}
+	return blob, nil
+}
+
+// BlobExists reports whether the blob with the given digest exists in the repository of ref.
+func (c *Client) BlobExists(ref Reference, d digest.Digest) (bool, error) {
+	request, err := http.NewRequest("HEAD", ref.BlobURL(d), nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := c.do(request, "")
+	if IsNotFound(err) {
+		return false, nil
+	}
+	closeResponse(response)
+	return err == nil, err
+}
+
+// PutBlob uploads the blob to the repository of ref, unless it is already there, and returns its descriptor.
+func (c *Client) PutBlob(ref Reference, mediaType string, blob []byte) (distribution.Descriptor, error) {
+	descriptor := distribution.Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(blob)),
+		Digest:    digest.FromBytes(blob),
+	}
+	exists, err := c.BlobExists(ref, descriptor.Digest)
+	if err != nil || exists {
+		return descriptor, err
+	}
+	err = c.uploadBlob(ref, descriptor.Digest, descriptor.Size, bytes.NewReader(blob))
+	if err != nil {
+		log.Println("failed to upload blob", ref.BlobURL(descriptor.Digest), err)
+	}
+	return descriptor, err
+}
+
+// MountBlob mounts the blob with the given digest from the repository of from into the repository of ref, which must
+// be on the same registry. It reports whether the registry mounted the blob; if it didn't, the blob has to be
+// uploaded.
+func (c *Client) MountBlob(ref Reference, from Reference, d digest.Digest) (bool, error) {
+	mounted, err := c.mountBlob(ref, from, d)
+	if err != nil {
+		log.Println("failed to mount blob", ref.BlobURL(d), "from", from.Repository, err)
+	}
+	return mounted, err
+}
+
+func (c *Client) mountBlob(ref Reference, from Reference, d digest.Digest) (bool, error) {
+	if ref.Host != from.Host {
+		return false, errors.New("cannot mount a blob from another registry - " + from.Host)
+	}
+	query := url.Values{"mount": {d.String()}, "from": {from.Repository}}
+	request, err := http.NewRequest("POST", ref.repositoryURL()+"/blobs/uploads/?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := c.do(request, "")
+	if err != nil {
+		return false, err
+	}
+	closeResponse(response)
+	if response.StatusCode == 201 {
+		return true, nil
+	}
+	// the registry started an upload instead, which isn't needed - cancelling it is best effort
+	if location, err := request.URL.Parse(response.Header.Get("Location")); err == nil && response.Header.Get("Location") != "" {
+		if request, err = http.NewRequest("DELETE", location.String(), nil); err == nil {
+			if response, err = c.do(request, ""); err == nil {
+				closeResponse(response)
+			}
+		}
+	}
+	return false, nil
+}
+
+// uploadBlob pushes size bytes of content as the blob using a monolithic upload: a POST to start the upload followed
+// by a single PUT that streams the content. If the content can seek it is rewound should the PUT need to be retried
+// after authenticating.
+func (c *Client) uploadBlob(ref Reference, d digest.Digest, size int64, content io.Reader) error {
+	request, err := http.NewRequest("POST", ref.repositoryURL()+"/blobs/uploads/", nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(request, "")
+	if err != nil {
+		return err
+	}
+	closeResponse(response)
+	if response.Header.Get("Location") == "" {
+		return errors.New("no Location header in upload response")
+	}
+	location, err := request.URL.Parse(response.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", d.String())
+	location.RawQuery = query.Encode()
+	// the transport closes the body once it is sent, which mustn't close a file the content may need to be re-read from
+	request, err = http.NewRequest("PUT", location.String(), ioutil.NopCloser(content))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	if seeker, ok := content.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		request.GetBody = func() (io.ReadCloser, error) {
+			_, err := seeker.Seek(start, io.SeekStart)
+			return ioutil.NopCloser(content), err
+		}
+	}
+	setHeader(request, "Content-Type", "application/octet-stream")
+	response, err = c.do(request, "")
+	closeResponse(response)
+	return err
+}
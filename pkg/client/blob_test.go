@@ -0,0 +1,194 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/vleurgat/dockerclient/pkg/registrytest"
+)
+
+func TestBlobExists(t *testing.T) {
+	ref, _ := ParseReference("my.host/repo:latest")
+
+	t.Run("exists", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 200})}
+		exists, err := client.BlobExists(ref, digest.FromString("hello"))
+		if !exists || err != nil {
+			t.Errorf("expected blob to exist and nil error; got %t and %s", exists, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 404})}
+		exists, err := client.BlobExists(ref, digest.FromString("hello"))
+		if exists || err != nil {
+			t.Errorf("expected blob not to exist and nil error; got %t and %s", exists, err)
+		}
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 304})}
+		exists, err := client.BlobExists(ref, digest.FromString("hello"))
+		if exists || err == nil || !strings.Contains(err.Error(), "status code 304") {
+			t.Errorf("expected status code 304; got %t and %s", exists, err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 500})}
+		exists, err := client.BlobExists(ref, digest.FromString("hello"))
+		if exists || err == nil || !strings.Contains(err.Error(), "status code 500") {
+			t.Errorf("expected status code 500; got %t and %s", exists, err)
+		}
+	})
+}
+
+func TestPutBlob(t *testing.T) {
+	ref, _ := ParseReference("my.host/repo:latest")
+
+	t.Run("already exists", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 200})}
+		descriptor, err := client.PutBlob(ref, "text/plain", []byte("hello"))
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if descriptor.Digest != digest.FromString("hello") || descriptor.Size != 5 || descriptor.MediaType != "text/plain" {
+			t.Errorf("unexpected descriptor; got %+v", descriptor)
+		}
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 202, Header: map[string][]string{"Location": {"/v2/repo/blobs/uploads/123?state=abc"}}},
+			http.Response{StatusCode: 201},
+		)}
+		_, err := client.PutBlob(ref, "text/plain", []byte("hello"))
+		if err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+	})
+
+	t.Run("closes responses", func(t *testing.T) {
+		var bodies []*closeTrackingBody
+		response := func(statusCode int, header http.Header) http.Response {
+			body := &closeTrackingBody{Reader: strings.NewReader("{}")}
+			bodies = append(bodies, body)
+			return http.Response{StatusCode: statusCode, Header: header, Body: body}
+		}
+		client := Client{client: CreateMockHTTPClient(
+			response(404, nil),
+			response(202, http.Header{"Location": {"/v2/repo/blobs/uploads/123"}}),
+			response(201, nil),
+		)}
+		if _, err := client.PutBlob(ref, "text/plain", []byte("hello")); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		for i, body := range bodies {
+			if !body.closed {
+				t.Errorf("expected response %d to be closed", i+1)
+			}
+		}
+	})
+
+	t.Run("streams and replays after authenticating", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, "blob"), []byte("hello"), 0644); err != nil {
+			t.Fatal("failed to write blob", err)
+		}
+		file, err := os.Open(filepath.Join(dir, "blob"))
+		if err != nil {
+			t.Fatal("failed to open blob", err)
+		}
+		defer file.Close()
+		mock := CreateScriptedHTTPClient(t,
+			Expectation{Method: "POST", StatusCode: 202, ResponseHeader: http.Header{"Location": {"/v2/repo/blobs/uploads/123"}}},
+			Expectation{Method: "PUT", StatusCode: 401, ResponseHeader: http.Header{"Www-Authenticate": {`Bearer realm="https://auth.host/token"`}}},
+			Expectation{Method: "GET", Path: "/token", Body: `{"token":"abc"}`},
+			Expectation{Method: "PUT", StatusCode: 201, Header: http.Header{"Authorization": {"Bearer abc"}}},
+		)
+		client := Client{client: mock}
+		if err = client.uploadBlob(ref, digest.FromString("hello"), 5, file); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		var bodies []string
+		for _, request := range mock.Requests() {
+			if request.Method == "PUT" {
+				bodies = append(bodies, string(request.Body))
+			}
+		}
+		if len(bodies) != 2 || bodies[0] != "hello" || bodies[1] != "hello" {
+			t.Errorf("expected the content to be sent twice; got %q", bodies)
+		}
+	})
+
+	t.Run("no location", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 202},
+		)}
+		_, err := client.PutBlob(ref, "text/plain", []byte("hello"))
+		if err == nil || !strings.Contains(err.Error(), "no Location header") {
+			t.Errorf("expected no Location header; got %s", err)
+		}
+	})
+}
+
+func TestMountBlob(t *testing.T) {
+	registry := registrytest.CreateRegistry()
+	defer registry.Close()
+	registry.SetTokenAuth("", "")
+	d := registry.PutBlob("base", []byte("layer"))
+	client := CreateClientProvidingHTTPClient(HTTPClientImpl{realHTTPClient: http.DefaultClient}, nil)
+	ref, _ := ParseReference(registry.ManifestURL("app", "latest"))
+	from, _ := ParseReference(registry.ManifestURL("base", "latest"))
+
+	t.Run("mounted", func(t *testing.T) {
+		mounted, err := client.MountBlob(ref, from, d)
+		if err != nil || !mounted {
+			t.Fatalf("expected the blob to be mounted; got %t and %v", mounted, err)
+		}
+		var tokenRequests []string
+		for _, request := range registry.Requests() {
+			if strings.HasPrefix(request, "GET /token") {
+				tokenRequests = append(tokenRequests, request)
+			}
+		}
+		if len(tokenRequests) != 1 || !strings.Contains(tokenRequests[0], "scope=repository%3Abase%3Apull") {
+			t.Errorf("expected one token for both repositories; got %s", tokenRequests)
+		}
+		if exists, err := client.BlobExists(ref, d); err != nil || !exists {
+			t.Errorf("expected the blob to exist; got %t and %v", exists, err)
+		}
+	})
+
+	t.Run("not mounted", func(t *testing.T) {
+		mounted, err := client.MountBlob(ref, from, digest.FromString("missing"))
+		if err != nil || mounted {
+			t.Errorf("expected the blob not to be mounted; got %t and %v", mounted, err)
+		}
+	})
+
+	t.Run("other registry", func(t *testing.T) {
+		other, _ := ParseReference("other.host/base")
+		if _, err := client.MountBlob(ref, other, d); err == nil || !strings.Contains(err.Error(), "another registry") {
+			t.Errorf("expected another registry; got %v", err)
+		}
+	})
+}
+
+type closeTrackingBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"io"
+	"log"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/vleurgat/dockerclient/pkg/cache"
+)
+
+func (c *Client) getCached(d digest.Digest) ([]byte, bool) {
+	if c.cache == nil || d == "" {
+		return nil, false
+	}
+	return c.cache.Get(d)
+}
+
+func (c *Client) putCached(d digest.Digest, content []byte) {
+	if c.cache == nil {
+		return
+	}
+	if err := c.cache.Put(d, content); err != nil {
+		log.Println("failed to cache", d, err)
+	}
+}
+
+// blobURLDigest returns the digest at the end of a blob URL, or an empty digest if the URL isn't a blob URL.
+func blobURLDigest(url string) digest.Digest {
+	i := strings.LastIndex(url, "/blobs/")
+	if i < 0 {
+		return ""
+	}
+	d, err := digest.Parse(url[i+len("/blobs/"):])
+	if err != nil {
+		return ""
+	}
+	return d
+}
+
+// cachingReader copies everything read from a blob response into the cache, committing it when the whole blob has
+// been read.
+type cachingReader struct {
+	io.ReadCloser
+	writer *cache.Writer
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.writer == nil {
+		return n, err
+	}
+	if _, writeErr := r.writer.Write(p[:n]); writeErr != nil {
+		r.writer.Close()
+		r.writer = nil
+	} else if err == io.EOF {
+		if commitErr := r.writer.Commit(); commitErr != nil {
+			log.Println("failed to cache blob", commitErr)
+		}
+		r.writer = nil
+	}
+	return n, err
+}
+
+func (r *cachingReader) Close() error {
+	if r.writer != nil {
+		r.writer.Close()
+	}
+	return r.ReadCloser.Close()
+}
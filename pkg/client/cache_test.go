@@ -0,0 +1,61 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	"github.com/vleurgat/dockerclient/pkg/cache"
+)
+
+func TestClientCache(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	blobCache, err := cache.CreateCache(dir, 0)
+	if err != nil {
+		t.Fatal("failed to create cache", err)
+	}
+	ref, _ := ParseReference("http://hello/v2/repo/manifests/latest")
+	manifest := testImage(t, "config", "layer")
+
+	t.Run("blob", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(blobResponse("hello"))}
+		client.SetCache(blobCache)
+		reader, err := client.openBlob(ref.BlobURL(digest.FromString("hello")))
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		ioutil.ReadAll(reader)
+		reader.Close()
+		client.client = CreateMockHTTPClientErr(errors.New("offline"))
+		blob, err := client.getVerifiedBlob(ref, digest.FromString("hello"))
+		if err != nil || string(blob) != "hello" {
+			t.Errorf("expected cached hello; got %s and %s", blob, err)
+		}
+	})
+
+	t.Run("manifest by digest", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse(schema2.MediaTypeManifest, manifest))}
+		client.SetCache(blobCache)
+		url := ref.WithDigest(digest.FromString(manifest)).ManifestURL()
+		if _, err := client.GetManifest(url); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		client.client = CreateMockHTTPClientErr(errors.New("offline"))
+		cached, err := client.GetManifest(url)
+		if err != nil || cached.MediaType != schema2.MediaTypeManifest || string(cached.Payload) != manifest {
+			t.Errorf("expected cached manifest; got %+v and %s", cached, err)
+		}
+	})
+
+	t.Run("manifest by tag", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClientErr(errors.New("offline"))}
+		client.SetCache(blobCache)
+		if _, err := client.GetManifest(ref.ManifestURL()); err == nil {
+			t.Error("expected tags not to be served from the cache")
+		}
+	})
+}
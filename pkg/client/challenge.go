@@ -0,0 +1,209 @@
+package client
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// challenge is an authentication challenge from a WWW-Authenticate header, as described by RFC 7235. The scheme and
+// parameter names are lower case, as both are case-insensitive.
+type challenge struct {
+	scheme     string
+	parameters map[string]string
+	token68    string
+}
+
+// String formats the challenge as it would appear in a WWW-Authenticate header, with parameters sorted by name.
+func (c challenge) String() string {
+	if c.token68 != "" {
+		return c.scheme + " " + c.token68
+	}
+	names := make([]string, 0, len(c.parameters))
+	for name := range c.parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = name + "=" + quote(c.parameters[name])
+	}
+	if len(params) == 0 {
+		return c.scheme
+	}
+	return c.scheme + " " + strings.Join(params, ", ")
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// getChallenges returns the challenges from all of the response's WWW-Authenticate headers.
+func getChallenges(response *http.Response) []challenge {
+	var challenges []challenge
+	for _, header := range response.Header.Values("Www-Authenticate") {
+		challenges = append(challenges, parseChallenges(header)...)
+	}
+	return challenges
+}
+
+// findChallenge returns the first challenge with the given lower case scheme.
+func findChallenge(challenges []challenge, scheme string) (challenge, bool) {
+	for _, c := range challenges {
+		if c.scheme == scheme {
+			return c, true
+		}
+	}
+	return challenge{}, false
+}
+
+// parseChallenges parses the challenges in a WWW-Authenticate header value. Each challenge is a scheme followed by
+// either a token68 or a comma separated list of parameters, and challenges are themselves separated by commas, as in:
+//
+//	Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"
+//
+// Parameter values may be tokens or quoted strings with backslash escapes. Registries don't always stick to the
+// grammar, so unquoted values run up to the next comma or whitespace rather than being limited to token characters,
+// and anything that can't be parsed is skipped up to the next comma.
+func parseChallenges(header string) []challenge {
+	p := challengeParser{s: header}
+	var challenges []challenge
+	for {
+		p.skip(" \t,")
+		if p.done() {
+			return challenges
+		}
+		scheme := p.token()
+		if scheme == "" {
+			p.skipPast(",")
+			continue
+		}
+		c := challenge{scheme: strings.ToLower(scheme), parameters: make(map[string]string)}
+		p.skip(" \t")
+		if token68, ok := p.token68(); ok {
+			c.token68 = token68
+		} else {
+			p.parameters(c.parameters)
+		}
+		challenges = append(challenges, c)
+	}
+}
+
+// challengeParser holds the position in a header value being parsed.
+type challengeParser struct {
+	s   string
+	pos int
+}
+
+func (p *challengeParser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *challengeParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *challengeParser) skip(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *challengeParser) skipPast(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	if !p.done() {
+		p.pos++
+	}
+}
+
+func (p *challengeParser) span(accept func(byte) bool) string {
+	start := p.pos
+	for !p.done() && accept(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *challengeParser) token() string {
+	return p.span(isTokenChar)
+}
+
+// token68 reads a token68, which must be the whole of the challenge after the scheme. If there isn't one the position
+// is left unchanged.
+func (p *challengeParser) token68() (string, bool) {
+	start := p.pos
+	token68 := p.span(isToken68Char)
+	token68 += p.span(func(b byte) bool { return b == '=' })
+	p.skip(" \t")
+	if len(token68) > 0 && token68[0] != '=' && (p.done() || p.peek() == ',') {
+		return token68, true
+	}
+	p.pos = start
+	return "", false
+}
+
+// parameters reads parameters into params until it reaches the end of the header or the start of the next challenge.
+// The first value of a repeated parameter wins.
+func (p *challengeParser) parameters(params map[string]string) {
+	for {
+		p.skip(" \t,")
+		start := p.pos
+		name := p.token()
+		p.skip(" \t")
+		if name == "" || p.peek() != '=' {
+			// the end of the header, the next challenge's scheme, or rubbish
+			p.pos = start
+			if name == "" && !p.done() {
+				p.skipPast(",")
+				continue
+			}
+			return
+		}
+		p.pos++
+		p.skip(" \t")
+		value := p.value()
+		name = strings.ToLower(name)
+		if _, exists := params[name]; !exists {
+			params[name] = value
+		}
+	}
+}
+
+func (p *challengeParser) value() string {
+	if p.peek() != '"' {
+		return p.span(func(b byte) bool { return b != ',' && b != ' ' && b != '\t' })
+	}
+	p.pos++
+	var value strings.Builder
+	for !p.done() {
+		b := p.s[p.pos]
+		p.pos++
+		switch {
+		case b == '"':
+			return value.String()
+		case b == '\\' && !p.done():
+			value.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			value.WriteByte(b)
+		}
+	}
+	return value.String()
+}
+
+func isTokenChar(b byte) bool {
+	return isAlphaNumeric(b) || strings.IndexByte("!#$%&'*+-.^_`|~", b) >= 0
+}
+
+func isToken68Char(b byte) bool {
+	return isAlphaNumeric(b) || strings.IndexByte("-._~+/", b) >= 0
+}
+
+func isAlphaNumeric(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	for name, test := range map[string]struct {
+		header   string
+		expected []challenge
+	}{
+		"empty":       {"", nil},
+		"scheme only": {"Negotiate", []challenge{{"negotiate", map[string]string{}, ""}}},
+		"no commas":   {`Bearer one="hello"`, []challenge{{"bearer", map[string]string{"one": "hello"}, ""}}},
+		"three entries": {`Bearer one="aaa",two="bbb",three="ccc"`,
+			[]challenge{{"bearer", map[string]string{"one": "aaa", "two": "bbb", "three": "ccc"}, ""}}},
+		"two entries with commas": {`Bearer t1="hello,there" , t2="goodbye,again"`,
+			[]challenge{{"bearer", map[string]string{"t1": "hello,there", "t2": "goodbye,again"}, ""}}},
+		"unquoted": {`Bearer realm=https://auth.io/token,service=registry.io, scope = repository:a/b:pull`,
+			[]challenge{{"bearer", map[string]string{"realm": "https://auth.io/token", "service": "registry.io", "scope": "repository:a/b:pull"}, ""}}},
+		"empty values": {`Bearer realm="", service=,scope=""`,
+			[]challenge{{"bearer", map[string]string{"realm": "", "service": "", "scope": ""}, ""}}},
+		"escapes": {`Newauth title="Login to \"apps\"", path="c:\\apps\\"`,
+			[]challenge{{"newauth", map[string]string{"title": `Login to "apps"`, "path": `c:\apps\`}, ""}}},
+		"names": {`Bearer Error_Description="bad", X-Request-ID=7, REALM="r"`,
+			[]challenge{{"bearer", map[string]string{"error_description": "bad", "x-request-id": "7", "realm": "r"}, ""}}},
+		"repeated": {`Bearer realm="one", realm="two"`, []challenge{{"bearer", map[string]string{"realm": "one"}, ""}}},
+		"token68": {"Basic dXNlcjpwYXNz==, Negotiate a+b/c",
+			[]challenge{{"basic", map[string]string{}, "dXNlcjpwYXNz=="}, {"negotiate", map[string]string{}, "a+b/c"}}},
+		"several": {`Newauth realm="apps", type=1, title="Login", Basic realm="simple", Bearer`, []challenge{
+			{"newauth", map[string]string{"realm": "apps", "type": "1", "title": "Login"}, ""},
+			{"basic", map[string]string{"realm": "simple"}, ""},
+			{"bearer", map[string]string{}, ""},
+		}},
+		"rubbish": {`"oops", Basic realm="simple", =, Bearer realm="a", "b", service="c`, []challenge{
+			{"basic", map[string]string{"realm": "simple"}, ""},
+			{"bearer", map[string]string{"realm": "a", "service": "c"}, ""},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			challenges := parseChallenges(test.header)
+			if !reflect.DeepEqual(challenges, test.expected) {
+				t.Errorf("expected %v; got %v", test.expected, challenges)
+			}
+		})
+	}
+}
+
+func TestChallengeString(t *testing.T) {
+	c := challenge{"bearer", map[string]string{"service": "s", "realm": `say "hi"\`}, ""}
+	if s := c.String(); s != `bearer realm="say \"hi\"\\", service="s"` {
+		t.Errorf("unexpected string; got %s", s)
+	}
+}
+
+func FuzzParseChallenges(f *testing.F) {
+	for _, seed := range []string{
+		`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`,
+		`Basic realm="Registry Realm"`,
+		`Newauth realm="apps", type=1, title="Login to \"apps\"", Basic realm="simple"`,
+		"Negotiate dXNlcjpwYXNz==, Basic",
+		`Bearer realm=http://boo,service="s&1", scope=s2`,
+		`, ,"x=`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, header string) {
+		challenges := parseChallenges(header)
+		formatted := ""
+		for i, c := range challenges {
+			if c.scheme == "" {
+				t.Fatalf("expected a scheme; got %v", c)
+			}
+			if i > 0 {
+				formatted += ", "
+			}
+			formatted += c.String()
+		}
+		// formatting and parsing again must be lossless
+		if reparsed := parseChallenges(formatted); !reflect.DeepEqual(reparsed, challenges) {
+			t.Errorf("%q parsed as %v but %q parsed as %v", header, challenges, formatted, reparsed)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/docker/cli/cli/config/configfile"
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/vleurgat/dockerclient/pkg/cache"
 )
 
 // HTTPClient acts as facade on http.Client, allowing for mock implementations.
@@ -33,6 +35,10 @@ func (h HTTPClientImpl) Do(req *http.Request) (*http.Response, error) {
 type Client struct {
 	client       HTTPClient
 	dockerConfig *configfile.ConfigFile
+	cache        *cache.Cache
+	etags        *etagCache
+	tokens       *tokenCache
+	credentials  CredentialProvider
 }
 
 // CreateClientProvidingHTTPClient create a Client object, using the provided HttpClient implementation.
@@ -40,6 +46,8 @@ func CreateClientProvidingHTTPClient(httpClient HTTPClient, dockerConfig *config
 	return Client{
 		client:       httpClient,
 		dockerConfig: dockerConfig,
+		etags:        newETagCache(),
+		tokens:       newTokenCache(),
 	}
 }
 
@@ -50,9 +58,23 @@ func CreateClient(dockerConfig *configfile.ConfigFile) Client {
 			realHTTPClient: &http.Client{Timeout: 10 * time.Second},
 		},
 		dockerConfig: dockerConfig,
+		etags:        newETagCache(),
+		tokens:       newTokenCache(),
 	}
 }
 
+// SetCache makes the Client keep anything it fetches by digest, i.e. blobs and manifests, in the cache and look
+// there first on subsequent fetches. A nil cache turns caching off.
+func (c *Client) SetCache(blobCache *cache.Cache) {
+	c.cache = blobCache
+}
+
+// SetCredentialProvider makes the Client get registry credentials from the provider rather than its Docker config. A
+// nil provider goes back to the Docker config; to use both, chain them with a ChainProvider.
+func (c *Client) SetCredentialProvider(provider CredentialProvider) {
+	c.credentials = provider
+}
+
 func (c *Client) doGet(queryURL string, target interface{}) error {
 	request, err := http.NewRequest("GET", queryURL, nil)
 	if err != nil {
@@ -89,47 +111,80 @@ func setBody(request *http.Request, body string) {
 	}
 }
 
+// closeResponse drains and closes the body of a response whose content isn't needed, so the connection can be reused.
+func closeResponse(response *http.Response) {
+	if response != nil && response.Body != nil {
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+	}
+}
+
 func (c *Client) doRequest(request *http.Request, target interface{}, body string) error {
-	basicAuth := c.getDockerBasicAuth(request.Host)
-	setHeader(request, "Authorization", basicAuth)
-	response, err := c.client.Do(request)
+	response, err := c.do(request, body)
 	if err != nil {
 		return err
 	}
+	defer closeResponse(response)
+	if target != nil {
+		err = json.NewDecoder(response.Body).Decode(target)
+	}
+	return err
+}
+
+// do sends the request, authenticating as the registry asks if it responds with a 401, and returns the successful
+// response. A cached token is sent up front if it covers the scopes the request needs.
+func (c *Client) do(request *http.Request, body string) (*http.Response, error) {
+	basicAuth := c.getDockerBasicAuth(request.Host, requestRepository(request))
+	scopes := requiredScopes(request)
+	if token, exists := c.tokens.get(request.Host, basicAuth); exists && coversScopes(token.scopes, scopes) {
+		setHeader(request, "Authorization", token.auth)
+	} else {
+		setHeader(request, "Authorization", basicAuth)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
 	switch response.StatusCode {
 	case 401:
-		// try bearer
-		bearerAuth, err := c.getDockerBearerAuth(response, basicAuth)
-		if err != nil {
-			return err
-		}
-		setHeader(request, "Authorization", bearerAuth)
-		setBody(request, body)
-		response, err = c.client.Do(request)
-		if err != nil {
-			return err
-		}
-		if response.StatusCode != 200 && response.StatusCode != 201 {
-			return errors.New("failed to get a good response with bearer auth - status code is " + strconv.Itoa(response.StatusCode))
-		}
-	case 200, 201:
+		return c.authenticate(request, body, response, basicAuth, scopes)
+	case 200, 201, 202, 204:
 		// all good - nothing to do
 	default:
 		// oops
-		return errors.New("failed to get a good response - status code " + strconv.Itoa(response.StatusCode))
-	}
-	err = nil
-	if target != nil {
-		defer response.Body.Close()
-		err = json.NewDecoder(response.Body).Decode(target)
+		closeResponse(response)
+		return nil, StatusError{StatusCode: response.StatusCode, message: "failed to get a good response - status code "}
 	}
-	return err
+	return response, nil
+}
+
+func isSuccess(statusCode int) bool {
+	return statusCode == 200 || statusCode == 201 || statusCode == 202 || statusCode == 204
+}
+
+// StatusError is returned when the registry responds with an unexpected HTTP status code.
+type StatusError struct {
+	StatusCode int
+	message    string
+}
+
+func (e StatusError) Error() string {
+	return e.message + strconv.Itoa(e.StatusCode)
+}
+
+// IsNotFound reports whether the error is a StatusError for a 404 response.
+func IsNotFound(err error) bool {
+	statusErr, ok := err.(StatusError)
+	return ok && statusErr.StatusCode == 404
 }
 
 // GetV2Manifest returns the Docker V2 manifest object that corresponds with the provided registry URL.
 func (c *Client) GetV2Manifest(url string) (schema2.Manifest, error) {
 	v2Manifest := schema2.Manifest{}
 	err := c.doGet(url, &v2Manifest)
+	if err == nil && v2Manifest.SchemaVersion == 1 {
+		err = errors.New("registry returned a schema1 manifest - use GetManifest and ConvertSchema1 instead")
+	}
 	if err != nil {
 		log.Println("failed to GET v2 manifest", url, err)
 	}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+)
+
+// Credential is a username and password for a registry, or the base64 encoded username:password pair found in the
+// auth field of Docker config files.
+type Credential struct {
+	Username string
+	Password string
+	Auth     string
+}
+
+// IsEmpty reports whether the credential has nothing to authenticate with.
+func (c Credential) IsEmpty() bool {
+	return c.Auth == "" && (c.Username == "" || c.Password == "")
+}
+
+// basicAuth returns the Authorization header value for the credential, or an empty string if it is empty.
+func (c Credential) basicAuth() string {
+	if c.Auth != "" {
+		return "Basic " + c.Auth
+	}
+	if c.IsEmpty() {
+		return ""
+	}
+	return "Basic " + base64Encode(c.Username, c.Password)
+}
+
+// CredentialProvider supplies the credentials for registry hosts, such as my.registry.io or localhost:5000. The host
+// may be followed by a namespace, as in quay.io/org, for credentials that only apply to part of a registry. A provider
+// with no credentials for a host returns an empty Credential rather than an error; errors are for failures such as
+// an unreachable secret store.
+type CredentialProvider interface {
+	Credentials(ctx context.Context, host string) (Credential, error)
+}
+
+// DockerConfigProvider is a CredentialProvider for the auths of a Docker config file.
+type DockerConfigProvider struct {
+	config *configfile.ConfigFile
+}
+
+// CreateDockerConfigProvider creates a DockerConfigProvider for the config, which may be nil.
+func CreateDockerConfigProvider(config *configfile.ConfigFile) DockerConfigProvider {
+	return DockerConfigProvider{config: config}
+}
+
+// Credentials returns the credentials in the config's auths for the host.
+func (d DockerConfigProvider) Credentials(ctx context.Context, host string) (Credential, error) {
+	if d.config == nil {
+		return Credential{}, nil
+	}
+	config := d.config.AuthConfigs[host]
+	return Credential{Username: config.Username, Password: config.Password, Auth: config.Auth}, nil
+}
+
+// EnvProvider is a CredentialProvider for environment variables named after the host, such as REGISTRY_USER_MY_HOST_IO
+// and REGISTRY_PASSWORD_MY_HOST_IO for my.host.io. The host is upper cased and anything other than letters and digits
+// replaced with underscores, so localhost:5000 becomes LOCALHOST_5000.
+type EnvProvider struct {
+	// Prefix replaces REGISTRY_ at the start of the variable names, if set.
+	Prefix string
+}
+
+// CreateEnvProvider creates an EnvProvider with the default REGISTRY_ prefix.
+func CreateEnvProvider() EnvProvider {
+	return EnvProvider{}
+}
+
+// Credentials returns the credentials in the environment for the host.
+func (e EnvProvider) Credentials(ctx context.Context, host string) (Credential, error) {
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = "REGISTRY_"
+	}
+	suffix := envHostSuffix(host)
+	return Credential{
+		Username: os.Getenv(prefix + "USER_" + suffix),
+		Password: os.Getenv(prefix + "PASSWORD_" + suffix),
+	}, nil
+}
+
+func envHostSuffix(host string) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, host)
+}
+
+// StaticProvider is a CredentialProvider for a fixed map of hosts to credentials.
+type StaticProvider map[string]Credential
+
+// Credentials returns the credentials in the map for the host.
+func (s StaticProvider) Credentials(ctx context.Context, host string) (Credential, error) {
+	return s[host], nil
+}
+
+// ChainProvider is a CredentialProvider that asks each of its providers in turn, returning the first credentials
+// found. A provider that fails is skipped, and its error only returned if none of the others have credentials.
+type ChainProvider []CredentialProvider
+
+// Credentials returns the first credentials any of the providers have for the host.
+func (c ChainProvider) Credentials(ctx context.Context, host string) (Credential, error) {
+	var firstErr error
+	for _, provider := range c {
+		credential, err := provider.Credentials(ctx, host)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !credential.IsEmpty() {
+			return credential, nil
+		}
+	}
+	return Credential{}, firstErr
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+)
+
+type failingProvider struct{}
+
+func (f failingProvider) Credentials(ctx context.Context, host string) (Credential, error) {
+	return Credential{}, errors.New("vault sealed")
+}
+
+func TestCredentialProviders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("docker config", func(t *testing.T) {
+		provider := CreateDockerConfigProvider(&configfile.ConfigFile{AuthConfigs: map[string]types.AuthConfig{
+			"my.host": {Username: "me", Password: "secret"},
+		}})
+		if credential, err := provider.Credentials(ctx, "my.host"); err != nil || credential.basicAuth() != "Basic "+base64Encode("me", "secret") {
+			t.Errorf("expected me:secret; got %+v and %v", credential, err)
+		}
+		if credential, err := CreateDockerConfigProvider(nil).Credentials(ctx, "my.host"); err != nil || !credential.IsEmpty() {
+			t.Errorf("expected no credentials; got %+v and %v", credential, err)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("REGISTRY_USER_LOCALHOST_5000", "me")
+		t.Setenv("REGISTRY_PASSWORD_LOCALHOST_5000", "secret")
+		t.Setenv("CI_USER_MY_HOST_IO", "ci")
+		t.Setenv("CI_PASSWORD_MY_HOST_IO", "token")
+		if credential, err := CreateEnvProvider().Credentials(ctx, "localhost:5000"); err != nil || credential.Username != "me" || credential.Password != "secret" {
+			t.Errorf("expected me:secret; got %+v and %v", credential, err)
+		}
+		if credential, err := (EnvProvider{Prefix: "CI_"}).Credentials(ctx, "My.Host.io"); err != nil || credential.Username != "ci" || credential.Password != "token" {
+			t.Errorf("expected ci:token; got %+v and %v", credential, err)
+		}
+		if credential, err := CreateEnvProvider().Credentials(ctx, "other.io"); err != nil || !credential.IsEmpty() {
+			t.Errorf("expected no credentials; got %+v and %v", credential, err)
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		chain := ChainProvider{
+			failingProvider{},
+			StaticProvider{"a.io": {Username: "user-only"}},
+			StaticProvider{"a.io": {Auth: "YTpi"}, "b.io": {Username: "b", Password: "c"}},
+		}
+		if credential, err := chain.Credentials(ctx, "a.io"); err != nil || credential.Auth != "YTpi" {
+			t.Errorf("expected the second static credential; got %+v and %v", credential, err)
+		}
+		if credential, err := chain.Credentials(ctx, "b.io"); err != nil || credential.Username != "b" {
+			t.Errorf("expected b:c; got %+v and %v", credential, err)
+		}
+		if _, err := chain.Credentials(ctx, "c.io"); err == nil || err.Error() != "vault sealed" {
+			t.Errorf("expected vault sealed; got %v", err)
+		}
+		if credential, err := (ChainProvider{}).Credentials(ctx, "c.io"); err != nil || !credential.IsEmpty() {
+			t.Errorf("expected no credentials; got %+v and %v", credential, err)
+		}
+	})
+}
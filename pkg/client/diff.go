@@ -0,0 +1,276 @@
+package client
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ImageDiff describes how the image referenced by B differs from the image referenced by A.
+type ImageDiff struct {
+	A                string         `json:"a"`
+	B                string         `json:"b"`
+	DigestA          digest.Digest  `json:"digestA"`
+	DigestB          digest.Digest  `json:"digestB"`
+	Equal            bool           `json:"equal"`
+	PlatformsAdded   []string       `json:"platformsAdded,omitempty"`
+	PlatformsRemoved []string       `json:"platformsRemoved,omitempty"`
+	Platforms        []PlatformDiff `json:"platforms,omitempty"`
+}
+
+// PlatformDiff describes how the image for a single platform differs between A and B.
+type PlatformDiff struct {
+	Platform      string          `json:"platform"`
+	DigestA       digest.Digest   `json:"digestA"`
+	DigestB       digest.Digest   `json:"digestB"`
+	LayersAdded   []digest.Digest `json:"layersAdded,omitempty"`
+	LayersRemoved []digest.Digest `json:"layersRemoved,omitempty"`
+	ConfigChanges []ConfigChange  `json:"configChanges,omitempty"`
+}
+
+// ConfigChange describes a change to a single image config field. Labels and environment variables are reported
+// individually, e.g. Labels.version or Env.PATH; an empty Old or New means the value was added or removed.
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// platformImage is a single platform image found while resolving a reference; the manifest is only fetched when
+// it is needed.
+type platformImage struct {
+	digest   digest.Digest
+	manifest *imageManifest
+	config   *v1.Image
+}
+
+// Diff compares the images at the two registry manifest URLs, reporting platform, layer and config differences.
+func (c *Client) Diff(a, b string) (ImageDiff, error) {
+	result := ImageDiff{A: a, B: b}
+	refA, err := ParseReference(a)
+	if err != nil {
+		return result, err
+	}
+	refB, err := ParseReference(b)
+	if err != nil {
+		return result, err
+	}
+	imagesA, digestA, err := c.resolvePlatforms(refA)
+	if err != nil {
+		return result, err
+	}
+	imagesB, digestB, err := c.resolvePlatforms(refB)
+	if err != nil {
+		return result, err
+	}
+	result.DigestA, result.DigestB = digestA, digestB
+	result.Equal = digestA == digestB
+	if result.Equal {
+		return result, nil
+	}
+	for _, platform := range sortedPlatforms(imagesA) {
+		if _, exists := imagesB[platform]; !exists {
+			result.PlatformsRemoved = append(result.PlatformsRemoved, platform)
+		}
+	}
+	for _, platform := range sortedPlatforms(imagesB) {
+		imageA, exists := imagesA[platform]
+		if !exists {
+			result.PlatformsAdded = append(result.PlatformsAdded, platform)
+			continue
+		}
+		imageB := imagesB[platform]
+		if imageA.digest == imageB.digest {
+			continue
+		}
+		platformDiff, err := c.diffPlatform(refA, imageA, refB, imageB)
+		if err != nil {
+			return result, err
+		}
+		platformDiff.Platform = platform
+		result.Platforms = append(result.Platforms, platformDiff)
+	}
+	return result, nil
+}
+
+// resolvePlatforms returns the images a reference points at, keyed by platform, along with the top level digest.
+func (c *Client) resolvePlatforms(ref Reference) (map[string]*platformImage, digest.Digest, error) {
+	manifest, err := c.GetManifest(ref.ManifestURL())
+	if err != nil {
+		return nil, "", err
+	}
+	images := make(map[string]*platformImage)
+	if manifest.IsIndex() {
+		descriptors, err := manifest.indexManifests()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, descriptor := range descriptors {
+			// attestations all share the unknown/unknown platform, and aren't images to compare
+			if isAttestation(descriptor) {
+				continue
+			}
+			images[platformString(descriptor.Platform)] = &platformImage{digest: descriptor.Digest}
+		}
+		return images, manifest.Digest, nil
+	}
+	image := &platformImage{digest: manifest.Digest}
+	if err = c.loadPlatformImage(ref, image, manifest); err != nil {
+		return nil, "", err
+	}
+	images[platformString(manifestlist.PlatformSpec{
+		OS:           image.config.OS,
+		Architecture: image.config.Architecture,
+		Variant:      image.config.Variant,
+	})] = image
+	return images, manifest.Digest, nil
+}
+
+// loadPlatformImage fills in the image manifest and config, fetching the manifest first if it isn't provided.
+func (c *Client) loadPlatformImage(ref Reference, image *platformImage, manifest Manifest) error {
+	var err error
+	if manifest.Payload == nil {
+		manifest, err = c.GetManifest(ref.WithDigest(image.digest).ManifestURL())
+		if err != nil {
+			return err
+		}
+	}
+	im, err := manifest.imageManifest()
+	if err != nil {
+		return err
+	}
+	blob, err := c.getVerifiedBlob(ref, im.Config.Digest)
+	if err != nil {
+		return err
+	}
+	config := &v1.Image{}
+	if err = json.Unmarshal(blob, config); err != nil {
+		return err
+	}
+	image.manifest = &im
+	image.config = config
+	return nil
+}
+
+func (c *Client) diffPlatform(refA Reference, imageA *platformImage, refB Reference, imageB *platformImage) (PlatformDiff, error) {
+	result := PlatformDiff{DigestA: imageA.digest, DigestB: imageB.digest}
+	for _, pair := range []struct {
+		ref   Reference
+		image *platformImage
+	}{{refA, imageA}, {refB, imageB}} {
+		if pair.image.manifest == nil {
+			if err := c.loadPlatformImage(pair.ref, pair.image, Manifest{}); err != nil {
+				return result, err
+			}
+		}
+	}
+	layersA := make(map[digest.Digest]bool)
+	for _, layer := range imageA.manifest.Layers {
+		layersA[layer.Digest] = true
+	}
+	layersB := make(map[digest.Digest]bool)
+	for _, layer := range imageB.manifest.Layers {
+		layersB[layer.Digest] = true
+		if !layersA[layer.Digest] {
+			result.LayersAdded = append(result.LayersAdded, layer.Digest)
+		}
+	}
+	for _, layer := range imageA.manifest.Layers {
+		if !layersB[layer.Digest] {
+			result.LayersRemoved = append(result.LayersRemoved, layer.Digest)
+		}
+	}
+	result.ConfigChanges = diffConfig(imageA.config.Config, imageB.config.Config)
+	return result, nil
+}
+
+func diffConfig(a, b v1.ImageConfig) []ConfigChange {
+	var changes []ConfigChange
+	changes = append(changes, diffMaps("Labels", a.Labels, b.Labels)...)
+	changes = append(changes, diffMaps("Env", envMap(a.Env), envMap(b.Env))...)
+	if !equalArgs(a.Entrypoint, b.Entrypoint) {
+		changes = append(changes, ConfigChange{Field: "Entrypoint", Old: argsString(a.Entrypoint), New: argsString(b.Entrypoint)})
+	}
+	if !equalArgs(a.Cmd, b.Cmd) {
+		changes = append(changes, ConfigChange{Field: "Cmd", Old: argsString(a.Cmd), New: argsString(b.Cmd)})
+	}
+	return changes
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// argsString returns the arguments as a JSON array, as they are written in a Dockerfile, so that ["a b"] and
+// ["a", "b"] can be told apart.
+func argsString(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	s, _ := json.Marshal(args)
+	return string(s)
+}
+
+func diffMaps(field string, a, b map[string]string) []ConfigChange {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	var changes []ConfigChange
+	for _, key := range sorted {
+		if a[key] != b[key] {
+			changes = append(changes, ConfigChange{Field: field + "." + key, Old: a[key], New: b[key]})
+		}
+	}
+	return changes
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		} else {
+			m[parts[0]] = ""
+		}
+	}
+	return m
+}
+
+func platformString(platform manifestlist.PlatformSpec) string {
+	s := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		s += "/" + platform.Variant
+	}
+	return s
+}
+
+func sortedPlatforms(images map[string]*platformImage) []string {
+	var platforms []string
+	for platform := range images {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func testImage(t *testing.T, config string, layers ...string) string {
+	m := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString(config)},
+	}
+	for _, layer := range layers {
+		m.Layers = append(m.Layers, distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digest.FromString(layer)})
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal("failed to marshal manifest", err)
+	}
+	return string(payload)
+}
+
+func TestDiff(t *testing.T) {
+	configA := `{"os":"linux","architecture":"amd64","config":{"Env":["PATH=/bin","A=1"],"Entrypoint":["/a"],"Labels":{"v":"1"}}}`
+	configB := `{"os":"linux","architecture":"amd64","config":{"Env":["PATH=/usr/bin"],"Entrypoint":["/a"],"Labels":{"v":"2","new":"x"}}}`
+	manifestA := testImage(t, configA, "base", "old")
+	manifestB := testImage(t, configB, "base", "new")
+
+	t.Run("equal", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifestA),
+			blobResponse(configA),
+			manifestResponse(schema2.MediaTypeManifest, manifestA),
+			blobResponse(configA),
+		)}
+		diff, err := client.Diff("http://hello/v2/a/manifests/1", "http://hello/v2/b/manifests/1")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if !diff.Equal || diff.DigestA != digest.FromString(manifestA) || len(diff.Platforms) != 0 {
+			t.Errorf("expected equal images; got %+v", diff)
+		}
+	})
+
+	t.Run("differences", func(t *testing.T) {
+		list, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+			{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}},
+			{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		})
+		if err != nil {
+			t.Fatal("failed to create manifest list", err)
+		}
+		list.Manifests[0].Digest = digest.FromString(manifestB)
+		list.Manifests[1].Digest = digest.FromString("arm")
+		_, listPayload, _ := list.Payload()
+
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifestA),
+			blobResponse(configA),
+			manifestResponse(manifestlist.MediaTypeManifestList, string(listPayload)),
+			manifestResponse(schema2.MediaTypeManifest, manifestB),
+			blobResponse(configB),
+		)}
+		diff, err := client.Diff("http://hello/v2/a/manifests/1", "http://hello/v2/b/manifests/1")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if diff.Equal || len(diff.PlatformsRemoved) != 0 {
+			t.Errorf("expected differences; got %+v", diff)
+		}
+		if len(diff.PlatformsAdded) != 1 || diff.PlatformsAdded[0] != "linux/arm64/v8" {
+			t.Errorf("expected linux/arm64/v8 to be added; got %s", diff.PlatformsAdded)
+		}
+		if len(diff.Platforms) != 1 || diff.Platforms[0].Platform != "linux/amd64" {
+			t.Fatalf("expected linux/amd64 to differ; got %+v", diff.Platforms)
+		}
+		platform := diff.Platforms[0]
+		if len(platform.LayersAdded) != 1 || platform.LayersAdded[0] != digest.FromString("new") {
+			t.Errorf("expected new layer to be added; got %s", platform.LayersAdded)
+		}
+		if len(platform.LayersRemoved) != 1 || platform.LayersRemoved[0] != digest.FromString("old") {
+			t.Errorf("expected old layer to be removed; got %s", platform.LayersRemoved)
+		}
+		expected := []ConfigChange{
+			{Field: "Labels.new", New: "x"},
+			{Field: "Labels.v", Old: "1", New: "2"},
+			{Field: "Env.A", Old: "1"},
+			{Field: "Env.PATH", Old: "/bin", New: "/usr/bin"},
+		}
+		if len(platform.ConfigChanges) != len(expected) {
+			t.Fatalf("unexpected config changes; got %+v", platform.ConfigChanges)
+		}
+		for i, change := range expected {
+			if platform.ConfigChanges[i] != change {
+				t.Errorf("expected %+v; got %+v", change, platform.ConfigChanges[i])
+			}
+		}
+	})
+
+	t.Run("attestations", func(t *testing.T) {
+		attestation := func(image string) manifestlist.ManifestDescriptor {
+			return manifestlist.ManifestDescriptor{
+				Descriptor: distribution.Descriptor{
+					Digest:      digest.FromString("attestation-" + image),
+					Annotations: map[string]string{"vnd.docker.reference.type": "attestation-manifest"},
+				},
+				Platform: manifestlist.PlatformSpec{OS: "unknown", Architecture: "unknown"},
+			}
+		}
+		list, _ := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+			{Descriptor: distribution.Descriptor{Digest: digest.FromString(manifestA)}, Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}},
+			attestation("amd64"),
+			attestation("arm64"),
+		})
+		_, listPayload, _ := list.Payload()
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifestA),
+			blobResponse(configA),
+			manifestResponse(manifestlist.MediaTypeManifestList, string(listPayload)),
+		)}
+		diff, err := client.Diff("http://hello/v2/a/manifests/1", "http://hello/v2/b/manifests/1")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if len(diff.PlatformsAdded) != 0 || len(diff.Platforms) != 0 {
+			t.Errorf("expected the attestations to be ignored; got %+v", diff)
+		}
+	})
+}
+
+func TestDiffConfig(t *testing.T) {
+	changes := diffConfig(v1.ImageConfig{Cmd: []string{"a b"}, Entrypoint: []string{"/e"}}, v1.ImageConfig{Cmd: []string{"a", "b"}, Entrypoint: []string{"/e"}})
+	if len(changes) != 1 || changes[0] != (ConfigChange{Field: "Cmd", Old: `["a b"]`, New: `["a","b"]`}) {
+		t.Errorf("expected only Cmd to change; got %+v", changes)
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"sync"
+)
+
+// etagCache remembers the ETag and manifest last returned for each tag URL, so that repeated fetches of a tag can be
+// made conditional with If-None-Match.
+type etagCache struct {
+	mutex   sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	etag     string
+	manifest Manifest
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{entries: make(map[string]etagEntry)}
+}
+
+func (e *etagCache) get(url string) (etagEntry, bool) {
+	if e == nil {
+		return etagEntry{}, false
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	entry, exists := e.entries[url]
+	return entry, exists
+}
+
+func (e *etagCache) put(url string, etag string, manifest Manifest) {
+	if e == nil || etag == "" {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.entries[url] = etagEntry{etag: etag, manifest: manifest}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestETag(t *testing.T) {
+	manifest := testImage(t, "config", "layer")
+	url := "http://hello/v2/repo/manifests/latest"
+
+	t.Run("not modified", func(t *testing.T) {
+		response := manifestResponse(schema2.MediaTypeManifest, manifest)
+		response.Header.Set("ETag", `"`+digest.FromString(manifest).String()+`"`)
+		client := CreateClientProvidingHTTPClient(CreateMockHTTPClient(response, http.Response{StatusCode: 304}), nil)
+		first, err := client.GetManifest(url)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		entry, exists := client.etags.get(url)
+		if !exists || entry.etag != `"`+digest.FromString(manifest).String()+`"` {
+			t.Errorf("expected etag to be remembered; got %+v", entry)
+		}
+		second, err := client.GetManifest(url)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if second.Digest != first.Digest || string(second.Payload) != manifest {
+			t.Errorf("expected the remembered manifest; got %+v", second)
+		}
+	})
+
+	t.Run("no etag", func(t *testing.T) {
+		client := CreateClientProvidingHTTPClient(CreateMockHTTPClient(manifestResponse(schema2.MediaTypeManifest, manifest)), nil)
+		client.GetManifest(url)
+		if _, exists := client.etags.get(url); exists {
+			t.Error("expected no etag to be remembered")
+		}
+	})
+
+	t.Run("unexpected not modified", func(t *testing.T) {
+		client := CreateClientProvidingHTTPClient(CreateMockHTTPClient(http.Response{StatusCode: 304}), nil)
+		_, err := client.GetManifest(url)
+		if err == nil || !strings.Contains(err.Error(), "status code 304") {
+			t.Errorf("expected status code 304; got %s", err)
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secrets in recorded fixtures.
+const redacted = "REDACTED"
+
+var (
+	secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	secretFields  = []string{"token", "access_token", "refresh_token", "password"}
+	// secretQueryParameters sign the presigned URLs that registries redirect blob downloads to
+	secretQueryParameters = []string{"X-Amz-Signature", "X-Amz-Credential", "X-Amz-Security-Token", "X-Goog-Signature",
+		"X-Goog-Credential", "Signature", "Key-Pair-Id", "Policy", "sig"}
+)
+
+// Interaction is a request and the response to it, as stored in a fixture file.
+type Interaction struct {
+	Request  InteractionRequest  `json:"request"`
+	Response InteractionResponse `json:"response"`
+}
+
+// InteractionRequest is the recorded part of a request.
+type InteractionRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// InteractionResponse is the recorded part of a response.
+type InteractionResponse struct {
+	StatusCode    int         `json:"statusCode"`
+	Header        http.Header `json:"header,omitempty"`
+	ContentLength int64       `json:"contentLength"`
+	Body          []byte      `json:"body,omitempty"`
+}
+
+// RecordingHTTPClient is an HTTPClient that passes requests on to another HTTPClient, recording each request and
+// response so that they can be saved as a fixture for a ReplayingHTTPClient. Credentials, tokens and the signatures
+// of presigned URLs are redacted. Only the bodies sent to and from token endpoints, which are the realms of the Bearer
+// challenges seen so far, are redacted, so that manifests and configs still match their digests when replayed.
+type RecordingHTTPClient struct {
+	client       HTTPClient
+	mutex        sync.Mutex
+	interactions []Interaction
+	realms       map[string]bool
+}
+
+// CreateRecordingHTTPClient creates a RecordingHTTPClient that sends requests with the client.
+func CreateRecordingHTTPClient(client HTTPClient) *RecordingHTTPClient {
+	return &RecordingHTTPClient{client: client, realms: make(map[string]bool)}
+}
+
+// Do sends the request and records it along with the response.
+func (r *RecordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	response, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	var responseBody []byte
+	if response.Body != nil {
+		responseBody, err = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	}
+	interaction := Interaction{
+		Request: InteractionRequest{
+			Method: req.Method,
+			URL:    redactURL(req.URL.String()),
+			Header: redactHeader(req.Header),
+			Body:   body,
+		},
+		Response: InteractionResponse{
+			StatusCode:    response.StatusCode,
+			Header:        redactHeader(response.Header),
+			ContentLength: response.ContentLength,
+			Body:          responseBody,
+		},
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.realms[realmKey(req.URL)] {
+		interaction.Request.Body = redactBody(body, req.Header.Get("Content-Type"))
+		interaction.Response.Body = redactBody(responseBody, response.Header.Get("Content-Type"))
+	}
+	if response.StatusCode == 401 {
+		if bearer, exists := findChallenge(getChallenges(response), "bearer"); exists {
+			if realm, err := url.Parse(bearer.parameters["realm"]); err == nil {
+				r.realms[realmKey(realm)] = true
+			}
+		}
+	}
+	r.interactions = append(r.interactions, interaction)
+	return response, nil
+}
+
+// realmKey identifies a token endpoint by its URL without the query, which holds the scopes of each token request.
+func realmKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// Save writes the interactions recorded so far to the fixture file.
+func (r *RecordingHTTPClient) Save(path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return writeJSONFile(path, r.interactions)
+}
+
+func redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range secretHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, redacted)
+		}
+	}
+	if location := header.Get("Location"); location != "" {
+		header.Set("Location", redactURL(location))
+	}
+	return header
+}
+
+// redactURL replaces the signature parameters of a presigned URL. URLs without them are returned as they are.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	changed := false
+	for name := range query {
+		for _, secret := range secretQueryParameters {
+			if strings.EqualFold(name, secret) {
+				query.Set(name, redacted)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redactBody replaces the values of secret fields in JSON objects and form bodies, which is where token endpoints
+// send and receive them.
+func redactBody(body []byte, contentType string) []byte {
+	var object map[string]interface{}
+	if json.Unmarshal(body, &object) == nil {
+		changed := false
+		for _, field := range secretFields {
+			if _, exists := object[field]; exists {
+				object[field] = redacted
+				changed = true
+			}
+		}
+		if changed {
+			if redactedBody, err := json.Marshal(object); err == nil {
+				return redactedBody
+			}
+		}
+		return body
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for _, field := range secretFields {
+				if form.Get(field) != "" {
+					form.Set(field, redacted)
+				}
+			}
+			return []byte(form.Encode())
+		}
+	}
+	return body
+}
+
+// ReplayingHTTPClient is an HTTPClient that answers requests from a fixture saved by a RecordingHTTPClient. Each
+// request gets the response of the first interaction not yet replayed with the same method and URL, so a sequence of
+// identical requests is answered in the order they were recorded. URLs are compared with their signatures redacted.
+type ReplayingHTTPClient struct {
+	mutex        sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// LoadReplayingHTTPClient creates a ReplayingHTTPClient from the fixture file.
+func LoadReplayingHTTPClient(path string) (*ReplayingHTTPClient, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []Interaction
+	if err = json.Unmarshal(content, &interactions); err != nil {
+		return nil, err
+	}
+	return &ReplayingHTTPClient{interactions: interactions, replayed: make([]bool, len(interactions))}, nil
+}
+
+// Do returns the recorded response to the request.
+func (r *ReplayingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] || interaction.Request.Method != req.Method || interaction.Request.URL != redactURL(req.URL.String()) {
+			continue
+		}
+		r.replayed[i] = true
+		return &http.Response{
+			StatusCode:    interaction.Response.StatusCode,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(interaction.Response.Body)),
+			ContentLength: interaction.Response.ContentLength,
+			Request:       req,
+		}, nil
+	}
+	return nil, errors.New("no recorded response for " + req.Method + " " + req.URL.String())
+}
+
+// Remaining returns the number of recorded interactions that haven't been replayed.
+func (r *ReplayingHTTPClient) Remaining() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	remaining := 0
+	for _, replayed := range r.replayed {
+		if !replayed {
+			remaining++
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/vleurgat/dockerclient/pkg/registrytest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "session.json")
+	payload := `{"schemaVersion":2,"mediaType":"` + v1.MediaTypeImageManifest + `","config":{},"layers":[]}`
+
+	registry := registrytest.CreateRegistry()
+	defer registry.Close()
+	registry.SetTokenAuth("user", "s3cret")
+	registry.PutManifest("app", "v1", v1.MediaTypeImageManifest, []byte(payload))
+	url := registry.ManifestURL("app", "v1")
+	ref, _ := ParseReference(url)
+	// a config with fields that look like secrets, which must be left alone so that it still matches its digest
+	configBlob := `{"config":{"Env":["A=1"]},"password":"not-a-secret","token":"not-a-secret"}`
+	configDigest := registry.PutBlob("app", []byte(configBlob))
+
+	recorder := CreateRecordingHTTPClient(HTTPClientImpl{realHTTPClient: http.DefaultClient})
+	config := &configfile.ConfigFile{AuthConfigs: map[string]types.AuthConfig{
+		registry.Host(): {Username: "user", Password: "s3cret"},
+	}}
+	client := CreateClientProvidingHTTPClient(recorder, config)
+	if _, err := client.GetManifest(url); err != nil {
+		t.Fatalf("expected nil error recording; got %s", err)
+	}
+	if _, err := client.HeadManifest(url); err != nil {
+		t.Fatalf("expected nil error recording; got %s", err)
+	}
+	if _, err := client.getVerifiedBlob(ref, configDigest); err != nil {
+		t.Fatalf("expected nil error recording; got %s", err)
+	}
+	if err := recorder.Save(fixture); err != nil {
+		t.Fatalf("expected nil error saving; got %s", err)
+	}
+
+	t.Run("redacted", func(t *testing.T) {
+		content, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{base64Encode("user", "s3cret"), "token-1"} {
+			if strings.Contains(string(content), secret) {
+				t.Errorf("expected %s to be redacted", secret)
+			}
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		replayer, err := LoadReplayingHTTPClient(fixture)
+		if err != nil {
+			t.Fatalf("expected nil error loading; got %s", err)
+		}
+		client := CreateClientProvidingHTTPClient(replayer, nil)
+		manifest, err := client.GetManifest(url)
+		if err != nil || manifest.Digest != digest.FromString(payload) {
+			t.Errorf("expected the recorded manifest; got %+v and %v", manifest, err)
+		}
+		descriptor, err := client.HeadManifest(url)
+		if err != nil || descriptor.Size != int64(len(payload)) {
+			t.Errorf("expected the recorded size; got %+v and %v", descriptor, err)
+		}
+		if blob, err := client.getVerifiedBlob(ref, configDigest); err != nil || string(blob) != configBlob {
+			t.Errorf("expected the recorded config; got %s and %v", blob, err)
+		}
+		if replayer.Remaining() != 0 {
+			t.Errorf("expected every interaction to be replayed; %d left", replayer.Remaining())
+		}
+		if _, err = client.GetManifest(url); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+			t.Errorf("expected no recorded response; got %v", err)
+		}
+	})
+}
+
+func TestRedactBody(t *testing.T) {
+	for name, test := range map[string]struct {
+		body        string
+		contentType string
+		expected    string
+	}{
+		"token":    {`{"token":"abc","expires_in":300}`, "application/json", `{"expires_in":300,"token":"REDACTED"}`},
+		"form":     {"grant_type=password&password=abc&username=me", "application/x-www-form-urlencoded", "grant_type=password&password=REDACTED&username=me"},
+		"manifest": {`{"schemaVersion":2}`, "application/json", `{"schemaVersion":2}`},
+		"binary":   {"\x1f\x8b", "application/octet-stream", "\x1f\x8b"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if result := string(redactBody([]byte(test.body), test.contentType)); result != test.expected {
+				t.Errorf("expected %s; got %s", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	for name, test := range map[string]struct {
+		url      string
+		expected string
+	}{
+		"plain": {"https://my.host/v2/repo/blobs/sha256:abc?b=2&a=1", "https://my.host/v2/repo/blobs/sha256:abc?b=2&a=1"},
+		"s3": {"https://bucket.s3.amazonaws.com/blob?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKIA&X-Amz-Signature=abc",
+			"https://bucket.s3.amazonaws.com/blob?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=REDACTED&X-Amz-Signature=REDACTED"},
+		"cloudfront": {"https://cdn.host/blob?Expires=1&Signature=abc&Key-Pair-Id=K1", "https://cdn.host/blob?Expires=1&Key-Pair-Id=REDACTED&Signature=REDACTED"},
+		"azure":      {"https://account.blob.core.windows.net/blob?se=2024&sig=abc", "https://account.blob.core.windows.net/blob?se=2024&sig=REDACTED"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if result := redactURL(test.url); result != test.expected {
+				t.Errorf("expected %s; got %s", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PushIndex assembles a multi-platform manifest list or image index from the manifests at the source registry URLs
+// and puts it to the target registry URL. Each source may be a single platform image, whose platform is read from its
+// config, or an index, whose entries are all included. Every child manifest must already exist in the target
+// repository. mediaType selects a Docker manifest list or an OCI image index; if empty, an OCI index is pushed when
+// all the children are OCI manifests and a Docker manifest list otherwise.
+func (c *Client) PushIndex(target string, mediaType string, sources ...string) (Manifest, error) {
+	index, err := c.pushIndex(target, mediaType, sources)
+	if err != nil {
+		log.Println("failed to push index", target, err)
+	}
+	return index, err
+}
+
+func (c *Client) pushIndex(target string, mediaType string, sources []string) (Manifest, error) {
+	if mediaType != "" && mediaType != manifestlist.MediaTypeManifestList && mediaType != v1.MediaTypeImageIndex {
+		return Manifest{}, errors.New("not a manifest list or image index media type: " + mediaType)
+	}
+	targetRef, err := ParseReference(target)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var descriptors []manifestlist.ManifestDescriptor
+	for _, source := range sources {
+		children, err := c.indexEntries(source)
+		if err != nil {
+			return Manifest{}, err
+		}
+		descriptors = append(descriptors, children...)
+	}
+	if len(descriptors) == 0 {
+		return Manifest{}, errors.New("no manifests to add to the index")
+	}
+	if err = c.checkIndexEntries(targetRef, descriptors); err != nil {
+		return Manifest{}, err
+	}
+	if mediaType == "" {
+		mediaType = v1.MediaTypeImageIndex
+		for _, descriptor := range descriptors {
+			if descriptor.MediaType != v1.MediaTypeImageManifest {
+				mediaType = manifestlist.MediaTypeManifestList
+			}
+		}
+	}
+	list, err := manifestlist.FromDescriptorsWithMediaType(descriptors, mediaType)
+	if err != nil {
+		return Manifest{}, err
+	}
+	_, payload, err := list.Payload()
+	if err != nil {
+		return Manifest{}, err
+	}
+	index := Manifest{MediaType: mediaType, Payload: payload}
+	if index.Digest, err = manifestDigest(mediaType, payload); err != nil {
+		return Manifest{}, err
+	}
+	_, err = c.putManifest(target, index)
+	return index, err
+}
+
+// indexEntries returns the index entries for the manifest at the source URL.
+func (c *Client) indexEntries(source string) ([]manifestlist.ManifestDescriptor, error) {
+	ref, err := ParseReference(source)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := c.GetManifest(source)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.IsIndex() {
+		return manifest.indexManifests()
+	}
+	image := &platformImage{digest: manifest.Digest}
+	if err = c.loadPlatformImage(ref, image, manifest); err != nil {
+		return nil, err
+	}
+	return []manifestlist.ManifestDescriptor{{
+		Descriptor: distribution.Descriptor{
+			MediaType: manifest.MediaType,
+			Size:      int64(len(manifest.Payload)),
+			Digest:    manifest.Digest,
+		},
+		Platform: manifestlist.PlatformSpec{
+			Architecture: image.config.Architecture,
+			OS:           image.config.OS,
+			OSVersion:    image.config.OSVersion,
+			OSFeatures:   image.config.OSFeatures,
+			Variant:      image.config.Variant,
+		},
+	}}, nil
+}
+
+// checkIndexEntries makes sure that the platforms of the images are distinct and that every entry exists in the target
+// repository. Attestations and entries without a platform aren't images, so may share one.
+func (c *Client) checkIndexEntries(target Reference, descriptors []manifestlist.ManifestDescriptor) error {
+	platforms := make(map[string]bool)
+	var missing []string
+	for _, descriptor := range descriptors {
+		platform := platformString(descriptor.Platform)
+		if !isAttestation(descriptor) {
+			if platforms[platform] {
+				return errors.New("more than one manifest for platform " + platform)
+			}
+			platforms[platform] = true
+		}
+		_, err := c.HeadManifest(target.WithDigest(descriptor.Digest).ManifestURL())
+		if IsNotFound(err) {
+			missing = append(missing, descriptor.Digest.String())
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("manifests missing from " + target.Host + "/" + target.Repository + ": " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// isAttestation reports whether the index entry is an attestation, such as the provenance and SBOM manifests that
+// buildx adds with the platform unknown/unknown, or otherwise has no platform.
+func isAttestation(descriptor manifestlist.ManifestDescriptor) bool {
+	if descriptor.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+		return true
+	}
+	platform := descriptor.Platform
+	return platform.OS == "" && platform.Architecture == "" || platform.OS == "unknown" && platform.Architecture == "unknown"
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPushIndex(t *testing.T) {
+	configAmd := `{"os":"linux","architecture":"amd64"}`
+	configArm := `{"os":"linux","architecture":"arm64","variant":"v8"}`
+	manifestAmd := testImage(t, configAmd, "amd")
+	manifestArm := testImage(t, configArm, "arm")
+
+	t.Run("success", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifestAmd),
+			blobResponse(configAmd),
+			manifestResponse(schema2.MediaTypeManifest, manifestArm),
+			blobResponse(configArm),
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 201},
+		)}
+		index, err := client.PushIndex("http://hello/v2/repo/manifests/multi", "",
+			"http://hello/v2/repo/manifests/amd", "http://hello/v2/repo/manifests/arm")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if index.MediaType != manifestlist.MediaTypeManifestList || index.Digest != digest.FromBytes(index.Payload) {
+			t.Errorf("unexpected index; got %+v", index)
+		}
+		entries, err := index.indexManifests()
+		if err != nil || len(entries) != 2 {
+			t.Fatalf("expected two entries; got %+v and %s", entries, err)
+		}
+		if entries[0].Digest != digest.FromString(manifestAmd) || platformString(entries[1].Platform) != "linux/arm64/v8" {
+			t.Errorf("unexpected entries; got %+v", entries)
+		}
+	})
+
+	t.Run("missing child", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifestAmd),
+			blobResponse(configAmd),
+			http.Response{StatusCode: 404},
+		)}
+		_, err := client.PushIndex("http://hello/v2/other/manifests/multi", "", "http://hello/v2/repo/manifests/amd")
+		if err == nil || !strings.Contains(err.Error(), "manifests missing from hello/other") {
+			t.Errorf("expected manifests missing; got %s", err)
+		}
+	})
+
+	t.Run("duplicate platform", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifestAmd),
+			blobResponse(configAmd),
+			manifestResponse(schema2.MediaTypeManifest, manifestAmd),
+			blobResponse(configAmd),
+			http.Response{StatusCode: 200},
+		)}
+		_, err := client.PushIndex("http://hello/v2/repo/manifests/multi", "",
+			"http://hello/v2/repo/manifests/amd", "http://hello/v2/repo/manifests/amd")
+		if err == nil || !strings.Contains(err.Error(), "more than one manifest for platform linux/amd64") {
+			t.Errorf("expected more than one manifest; got %s", err)
+		}
+	})
+
+	t.Run("attestations", func(t *testing.T) {
+		attestation := manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{
+				MediaType:   v1.MediaTypeImageManifest,
+				Annotations: map[string]string{"vnd.docker.reference.type": "attestation-manifest"},
+			},
+			Platform: manifestlist.PlatformSpec{OS: "unknown", Architecture: "unknown"},
+		}
+		buildxIndex := func(platform string, manifest string) string {
+			image := manifestlist.ManifestDescriptor{
+				Descriptor: distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString(manifest)},
+				Platform:   manifestlist.PlatformSpec{OS: "linux", Architecture: platform},
+			}
+			attestation.Digest = digest.FromString("attestation-" + platform)
+			list, _ := manifestlist.FromDescriptorsWithMediaType([]manifestlist.ManifestDescriptor{image, attestation}, v1.MediaTypeImageIndex)
+			_, payload, _ := list.Payload()
+			return string(payload)
+		}
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(v1.MediaTypeImageIndex, buildxIndex("amd64", manifestAmd)),
+			manifestResponse(v1.MediaTypeImageIndex, buildxIndex("arm64", manifestArm)),
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 201},
+		)}
+		index, err := client.PushIndex("http://hello/v2/repo/manifests/multi", "",
+			"http://hello/v2/repo/manifests/amd", "http://hello/v2/repo/manifests/arm")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if entries, err := index.indexManifests(); err != nil || len(entries) != 4 {
+			t.Errorf("expected four entries; got %+v and %v", entries, err)
+		}
+	})
+
+	t.Run("bad media type", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClientErr(errors.New("no requests expected"))}
+		_, err := client.PushIndex("http://hello/v2/repo/manifests/multi", schema2.MediaTypeManifest, "http://hello/v2/repo/manifests/amd")
+		if err == nil || !strings.Contains(err.Error(), "not a manifest list or image index") {
+			t.Errorf("expected not a manifest list; got %s", err)
+		}
+	})
+}
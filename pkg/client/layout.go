@@ -0,0 +1,377 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ExportOCILayout writes the image at the registry URL into an OCI image layout directory, creating the directory if
+// necessary and adding the image to any index.json already there. The image is annotated with its tag as its
+// org.opencontainers.image.ref.name. Blobs already present in the directory are reused, and every blob is verified
+// against its digest as it is written.
+//
+// If platforms, such as linux/amd64 or linux/arm/v7, are given then only those entries of a multi-platform image are
+// exported, under a new index listing just those platforms.
+func (c *Client) ExportOCILayout(url string, dir string, platforms ...string) error {
+	err := c.exportOCILayout(url, dir, platforms)
+	if err != nil {
+		log.Println("failed to export OCI layout", url, dir, err)
+	}
+	return err
+}
+
+func (c *Client) exportOCILayout(url string, dir string, platforms []string) error {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return err
+	}
+	manifest, err := c.GetManifest(url)
+	if err != nil {
+		return err
+	}
+	if manifest.IsIndex() {
+		manifest, err = c.exportIndex(ref, dir, manifest, platforms)
+	} else {
+		err = c.exportImage(ref, dir, manifest)
+	}
+	if err != nil {
+		return err
+	}
+	descriptor := v1.Descriptor{
+		MediaType: manifest.MediaType,
+		Digest:    manifest.Digest,
+		Size:      int64(len(manifest.Payload)),
+	}
+	if ref.Tag != "" {
+		descriptor.Annotations = map[string]string{v1.AnnotationRefName: ref.Tag}
+	}
+	return addToLayoutIndex(dir, descriptor)
+}
+
+// exportIndex writes the selected platforms of an index, returning the index that was written.
+func (c *Client) exportIndex(ref Reference, dir string, index Manifest, platforms []string) (Manifest, error) {
+	entries, err := index.indexManifests()
+	if err != nil {
+		return Manifest{}, err
+	}
+	if len(platforms) > 0 {
+		wanted := make(map[string]bool)
+		for _, platform := range platforms {
+			wanted[platform] = true
+		}
+		var selected []manifestlist.ManifestDescriptor
+		for _, entry := range entries {
+			if wanted[platformString(entry.Platform)] {
+				selected = append(selected, entry)
+			}
+		}
+		if len(selected) == 0 {
+			return Manifest{}, errors.New("none of the platforms are in " + ref.String())
+		}
+		list, err := manifestlist.FromDescriptorsWithMediaType(selected, index.MediaType)
+		if err != nil {
+			return Manifest{}, err
+		}
+		_, payload, err := list.Payload()
+		if err != nil {
+			return Manifest{}, err
+		}
+		index = Manifest{MediaType: index.MediaType, Digest: digest.FromBytes(payload), Payload: payload}
+		entries = selected
+	}
+	for _, entry := range entries {
+		child, err := c.GetManifest(ref.WithDigest(entry.Digest).ManifestURL())
+		if err != nil {
+			return Manifest{}, err
+		}
+		if err = c.exportImage(ref, dir, child); err != nil {
+			return Manifest{}, err
+		}
+	}
+	return index, writeLayoutBlob(dir, index.Digest, bytes.NewReader(index.Payload))
+}
+
+// exportImage writes the config and layers of a single platform image, followed by its manifest.
+func (c *Client) exportImage(ref Reference, dir string, manifest Manifest) error {
+	if manifest.IsSchema1() {
+		return errors.New("cannot export schema1 manifest - use ConvertSchema1 first")
+	}
+	im, err := manifest.imageManifest()
+	if err != nil {
+		return err
+	}
+	for _, descriptor := range append([]distribution.Descriptor{im.Config}, im.Layers...) {
+		if layoutBlobExists(dir, descriptor.Digest) {
+			continue
+		}
+		if err = descriptor.Digest.Validate(); err != nil {
+			return err
+		}
+		reader, err := c.openBlob(ref.BlobURL(descriptor.Digest))
+		if err != nil {
+			return err
+		}
+		err = writeLayoutBlob(dir, descriptor.Digest, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writeLayoutBlob(dir, manifest.Digest, bytes.NewReader(manifest.Payload))
+}
+
+func layoutBlobPath(dir string, d digest.Digest) string {
+	return filepath.Join(dir, "blobs", d.Algorithm().String(), d.Hex())
+}
+
+// layoutBlobExists reports whether the layout already holds a blob with the right content for the digest.
+func layoutBlobExists(dir string, d digest.Digest) bool {
+	if d.Validate() != nil {
+		return false
+	}
+	file, err := os.Open(layoutBlobPath(dir, d))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	verifier := d.Verifier()
+	_, err = io.Copy(verifier, file)
+	return err == nil && verifier.Verified()
+}
+
+// writeLayoutBlob writes the content to the layout via a temporary file, only moving it into place once the content
+// has been verified against the digest.
+func writeLayoutBlob(dir string, d digest.Digest, content io.Reader) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	verifier := d.Verifier()
+	return writeFileAtomically(layoutBlobPath(dir, d), func(w io.Writer) error {
+		if _, err := io.Copy(io.MultiWriter(w, verifier), content); err != nil {
+			return err
+		}
+		if !verifier.Verified() {
+			return errors.New("blob digest mismatch - expected " + d.String())
+		}
+		return nil
+	})
+}
+
+// writeFileAtomically creates the file's directory and calls write with a temporary file in it, renaming the
+// temporary file to path only if write succeeds.
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func writeJSONFile(path string, value interface{}) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(path, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// readLayoutIndex reads the index.json of the layout, which is empty if the file doesn't exist yet.
+func readLayoutIndex(dir string) (v1.Index, error) {
+	index := v1.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: v1.MediaTypeImageIndex}
+	content, err := ioutil.ReadFile(filepath.Join(dir, v1.ImageIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(content, &index)
+	return index, err
+}
+
+// addToLayoutIndex writes the oci-layout file and adds the descriptor to index.json, replacing any existing entry with
+// the same ref name, or the same digest when there is no ref name.
+func addToLayoutIndex(dir string, descriptor v1.Descriptor) error {
+	err := writeJSONFile(filepath.Join(dir, v1.ImageLayoutFile), v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	index, err := readLayoutIndex(dir)
+	if err != nil {
+		return err
+	}
+	refName := descriptor.Annotations[v1.AnnotationRefName]
+	var manifests []v1.Descriptor
+	for _, existing := range index.Manifests {
+		existingRefName := existing.Annotations[v1.AnnotationRefName]
+		if (refName != "" && existingRefName == refName) || (refName == "" && existingRefName == "" && existing.Digest == descriptor.Digest) {
+			continue
+		}
+		manifests = append(manifests, existing)
+	}
+	index.Manifests = append(manifests, descriptor)
+	return writeJSONFile(filepath.Join(dir, v1.ImageIndexFile), index)
+}
+
+// ImportOCILayout pushes an image from an OCI image layout directory to the registry URL. The image is the entry in
+// index.json whose org.opencontainers.image.ref.name annotation matches the URL's tag, or whose digest matches the
+// URL's digest. Blobs that already exist in the target repository are not uploaded again.
+func (c *Client) ImportOCILayout(dir string, url string) error {
+	err := c.importOCILayout(dir, url)
+	if err != nil {
+		log.Println("failed to import OCI layout", dir, url, err)
+	}
+	return err
+}
+
+func (c *Client) importOCILayout(dir string, url string) error {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return err
+	}
+	index, err := readLayoutIndex(dir)
+	if err != nil {
+		return err
+	}
+	for _, descriptor := range index.Manifests {
+		if layoutEntryMatches(descriptor, ref) {
+			return c.importManifest(dir, ref, descriptor, url)
+		}
+	}
+	return errors.New("no image for " + ref.String() + " in " + dir)
+}
+
+// layoutEntryMatches reports whether the index.json entry is the one the reference asks for. Ref names may be just a
+// tag, or an image name whose repository and tag must both match. The registry host of an image name is ignored, as a
+// layout is usually imported to a different registry from the one it was exported from.
+func layoutEntryMatches(descriptor v1.Descriptor, ref Reference) bool {
+	if ref.Tag == "" {
+		return descriptor.Digest == ref.Digest
+	}
+	refName := descriptor.Annotations[v1.AnnotationRefName]
+	if refName == ref.Tag {
+		return true
+	}
+	i := strings.LastIndex(refName, ":")
+	if i < 0 || i < strings.LastIndex(refName, "/") || refName[i+1:] != ref.Tag {
+		return false
+	}
+	name := refName[:i]
+	if j := strings.Index(name, "/"); j > 0 && (strings.ContainsAny(name[:j], ".:") || name[:j] == "localhost") {
+		name = name[j+1:]
+	}
+	return name == ref.Repository
+}
+
+// importManifest pushes the blobs and child manifests that the manifest refers to, then the manifest itself.
+func (c *Client) importManifest(dir string, ref Reference, descriptor v1.Descriptor, url string) error {
+	payload, err := readLayoutBlob(dir, descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	manifest := Manifest{MediaType: manifestMediaType(descriptor.MediaType, payload), Digest: descriptor.Digest, Payload: payload}
+	if manifest.IsIndex() {
+		entries, err := manifest.indexManifests()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			child := v1.Descriptor{MediaType: entry.MediaType, Digest: entry.Digest, Size: entry.Size}
+			if err = c.importManifest(dir, ref, child, ref.WithDigest(entry.Digest).ManifestURL()); err != nil {
+				return err
+			}
+		}
+	} else {
+		im, err := manifest.imageManifest()
+		if err != nil {
+			return err
+		}
+		for _, blob := range append([]distribution.Descriptor{im.Config}, im.Layers...) {
+			if err = c.importBlob(dir, ref, blob); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = c.putManifest(url, manifest)
+	return err
+}
+
+func (c *Client) importBlob(dir string, ref Reference, descriptor distribution.Descriptor) error {
+	exists, err := c.BlobExists(ref, descriptor.Digest)
+	if err != nil || exists {
+		return err
+	}
+	file, size, err := openLayoutBlob(dir, descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.uploadBlob(ref, descriptor.Digest, size, file)
+}
+
+// readLayoutBlob reads a blob from the layout, verifying it against its digest.
+func readLayoutBlob(dir string, d digest.Digest) ([]byte, error) {
+	file, _, err := openLayoutBlob(dir, d)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// openLayoutBlob opens a blob in the layout after verifying its content against its digest, returning the file and
+// its size. The content is read from the file as it is verified, so large layers needn't fit in memory.
+func openLayoutBlob(dir string, d digest.Digest) (*os.File, int64, error) {
+	if err := d.Validate(); err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(layoutBlobPath(dir, d))
+	if err != nil {
+		return nil, 0, err
+	}
+	verifier := d.Verifier()
+	size, err := io.Copy(verifier, file)
+	if err == nil && !verifier.Verified() {
+		err = errors.New("blob digest mismatch - expected " + d.String())
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, size, nil
+}
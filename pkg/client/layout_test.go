@@ -0,0 +1,190 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func createTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oci-layout")
+	if err != nil {
+		t.Fatal("failed to create temp dir", err)
+	}
+	return dir
+}
+
+func TestExportOCILayout(t *testing.T) {
+	config := `{"os":"linux","architecture":"amd64"}`
+	manifest := testImage(t, config, "layer")
+
+	t.Run("single image", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifest),
+			blobResponse(config),
+			blobResponse("layer"),
+		)}
+		err := client.ExportOCILayout("http://hello/v2/repo/manifests/v1", dir)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		for _, content := range []string{manifest, config, "layer"} {
+			blob, err := ioutil.ReadFile(layoutBlobPath(dir, digest.FromString(content)))
+			if err != nil || string(blob) != content {
+				t.Errorf("expected blob %s; got %s and %s", content, blob, err)
+			}
+		}
+		index, err := readLayoutIndex(dir)
+		if err != nil || len(index.Manifests) != 1 {
+			t.Fatalf("expected one index entry; got %+v and %s", index, err)
+		}
+		if index.Manifests[0].Digest != digest.FromString(manifest) || index.Manifests[0].Annotations[v1.AnnotationRefName] != "v1" {
+			t.Errorf("unexpected index entry; got %+v", index.Manifests[0])
+		}
+		layout, _ := ioutil.ReadFile(filepath.Join(dir, "oci-layout"))
+		if !strings.Contains(string(layout), `"imageLayoutVersion": "1.0.0"`) {
+			t.Errorf("unexpected oci-layout; got %s", layout)
+		}
+
+		// exporting again reuses the blobs and replaces the index entry
+		client = Client{client: CreateMockHTTPClient(manifestResponse(schema2.MediaTypeManifest, manifest))}
+		if err = client.ExportOCILayout("http://hello/v2/repo/manifests/v1", dir); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		index, _ = readLayoutIndex(dir)
+		if len(index.Manifests) != 1 {
+			t.Errorf("expected one index entry; got %+v", index)
+		}
+	})
+
+	t.Run("bad blob", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, manifest),
+			blobResponse("not the config"),
+		)}
+		err := client.ExportOCILayout("http://hello/v2/repo/manifests/v1", dir)
+		if err == nil || !strings.Contains(err.Error(), "blob digest mismatch") {
+			t.Errorf("expected blob digest mismatch; got %s", err)
+		}
+		if _, err = os.Stat(layoutBlobPath(dir, digest.FromString(config))); !os.IsNotExist(err) {
+			t.Errorf("expected no config blob; got %s", err)
+		}
+	})
+
+	t.Run("selected platforms", func(t *testing.T) {
+		dir := createTempDir(t)
+		defer os.RemoveAll(dir)
+		list, _ := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+			{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "amd64"}},
+			{Platform: manifestlist.PlatformSpec{OS: "linux", Architecture: "arm64"}},
+		})
+		list.Manifests[0].Digest = digest.FromString(manifest)
+		list.Manifests[1].Digest = digest.FromString("arm")
+		_, payload, _ := list.Payload()
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(manifestlist.MediaTypeManifestList, string(payload)),
+			manifestResponse(schema2.MediaTypeManifest, manifest),
+			blobResponse(config),
+			blobResponse("layer"),
+		)}
+		err := client.ExportOCILayout("http://hello/v2/repo/manifests/v1", dir, "linux/amd64")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		index, _ := readLayoutIndex(dir)
+		exported, err := ioutil.ReadFile(layoutBlobPath(dir, index.Manifests[0].Digest))
+		if err != nil {
+			t.Fatalf("expected exported index; got %s", err)
+		}
+		var exportedList manifestlist.ManifestList
+		json.Unmarshal(exported, &exportedList)
+		if len(exportedList.Manifests) != 1 || exportedList.Manifests[0].Platform.Architecture != "amd64" {
+			t.Errorf("expected just amd64; got %s", exported)
+		}
+	})
+}
+
+func TestImportOCILayout(t *testing.T) {
+	config := `{"os":"linux","architecture":"amd64"}`
+	manifest := testImage(t, config, "layer")
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+	for _, content := range []string{manifest, config, "layer"} {
+		if err := writeLayoutBlob(dir, digest.FromString(content), strings.NewReader(content)); err != nil {
+			t.Fatal("failed to write blob", err)
+		}
+	}
+	err := addToLayoutIndex(dir, v1.Descriptor{
+		MediaType:   schema2.MediaTypeManifest,
+		Digest:      digest.FromString(manifest),
+		Size:        int64(len(manifest)),
+		Annotations: map[string]string{v1.AnnotationRefName: "my.host/repo:v1"},
+	})
+	if err != nil {
+		t.Fatal("failed to write index", err)
+	}
+
+	t.Run("no such ref", func(t *testing.T) {
+		client := Client{}
+		err := client.ImportOCILayout(dir, "http://hello/v2/repo/manifests/v2")
+		if err == nil || !strings.Contains(err.Error(), "no image for hello/repo:v2") {
+			t.Errorf("expected no image; got %s", err)
+		}
+	})
+
+	t.Run("other repository", func(t *testing.T) {
+		err := addToLayoutIndex(dir, v1.Descriptor{
+			MediaType:   schema2.MediaTypeManifest,
+			Digest:      digest.FromString(manifest),
+			Size:        int64(len(manifest)),
+			Annotations: map[string]string{v1.AnnotationRefName: "my.host/other:v2"},
+		})
+		if err != nil {
+			t.Fatal("failed to write index", err)
+		}
+		client := Client{}
+		err = client.ImportOCILayout(dir, "http://hello/v2/repo/manifests/v2")
+		if err == nil || !strings.Contains(err.Error(), "no image for hello/repo:v2") {
+			t.Errorf("expected no image; got %s", err)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 202, Header: map[string][]string{"Location": {"/upload"}}},
+			http.Response{StatusCode: 201},
+			http.Response{StatusCode: 201},
+		)}
+		err := client.ImportOCILayout(dir, "http://hello/v2/repo/manifests/v1")
+		if err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+	})
+
+	t.Run("corrupt blob", func(t *testing.T) {
+		ioutil.WriteFile(layoutBlobPath(dir, digest.FromString("layer")), []byte("corrupt"), 0644)
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 200},
+			http.Response{StatusCode: 404},
+		)}
+		err := client.ImportOCILayout(dir, "http://hello/v2/repo/manifests/v1")
+		if err == nil || !strings.Contains(err.Error(), "blob digest mismatch") {
+			t.Errorf("expected blob digest mismatch; got %s", err)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package client
+
+import (
+	_ "crypto/sha256" // register the hash used by digest.Canonical
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// manifestMediaTypes are the manifest media types the client understands, in order of preference.
+var manifestMediaTypes = []string{
+	manifestlist.MediaTypeManifestList,
+	v1.MediaTypeImageIndex,
+	schema2.MediaTypeManifest,
+	v1.MediaTypeImageManifest,
+	schema1.MediaTypeSignedManifest,
+	schema1.MediaTypeManifest,
+}
+
+// Manifest is a manifest of any supported media type, exactly as served by the registry.
+type Manifest struct {
+	MediaType string
+	Digest    digest.Digest
+	Payload   []byte
+}
+
+// IsIndex reports whether the manifest is a Docker manifest list or an OCI image index.
+func (m Manifest) IsIndex() bool {
+	return m.MediaType == manifestlist.MediaTypeManifestList || m.MediaType == v1.MediaTypeImageIndex
+}
+
+// Unmarshal decodes the manifest payload into the distribution type registered for its media type.
+func (m Manifest) Unmarshal() (distribution.Manifest, error) {
+	dm, _, err := distribution.UnmarshalManifest(m.MediaType, m.Payload)
+	return dm, err
+}
+
+// GetManifest returns the manifest, of any supported media type, that corresponds with the provided registry URL.
+func (c *Client) GetManifest(url string) (Manifest, error) {
+	manifest, err := c.getManifest(url)
+	if err != nil {
+		log.Println("failed to GET manifest", url, err)
+	}
+	return manifest, err
+}
+
+func (c *Client) getManifest(url string) (Manifest, error) {
+	ref, _ := ParseReference(url)
+	if payload, ok := c.getCached(ref.Digest); ok {
+		return Manifest{MediaType: manifestMediaType("", payload), Digest: ref.Digest, Payload: payload}, nil
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return Manifest{}, err
+	}
+	setHeader(request, "Accept", strings.Join(manifestMediaTypes, ", "))
+	// tags are mutable, so rather than caching them by digest ask the registry whether the tag has moved
+	previous, conditional := c.etags.get(url)
+	if conditional && ref.Digest == "" {
+		setHeader(request, "If-None-Match", previous.etag)
+	}
+	response, err := c.do(request, "")
+	if statusErr, ok := err.(StatusError); ok && statusErr.StatusCode == 304 && conditional && ref.Digest == "" {
+		return previous.manifest, nil
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer response.Body.Close()
+	payload, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return Manifest{}, err
+	}
+	manifest := Manifest{
+		MediaType: manifestMediaType(response.Header.Get("Content-Type"), payload),
+		Payload:   payload,
+	}
+	manifest.Digest, err = manifestDigest(manifest.MediaType, payload)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if header := response.Header.Get("Docker-Content-Digest"); header != "" && header != manifest.Digest.String() {
+		return Manifest{}, errors.New("manifest digest mismatch - registry says " + header + " but content is " + manifest.Digest.String())
+	}
+	if ref.Digest != "" && ref.Digest != manifest.Digest {
+		return Manifest{}, errors.New("manifest digest mismatch - asked for " + ref.Digest.String() + " but content is " + manifest.Digest.String())
+	}
+	if ref.Digest != "" {
+		c.putCached(manifest.Digest, payload)
+	} else {
+		c.etags.put(url, response.Header.Get("ETag"), manifest)
+	}
+	return manifest, nil
+}
+
+// HeadManifest returns the descriptor of the manifest at the registry URL without fetching its content. The error
+// satisfies IsNotFound when there is no such manifest.
+func (c *Client) HeadManifest(url string) (distribution.Descriptor, error) {
+	request, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	setHeader(request, "Accept", strings.Join(manifestMediaTypes, ", "))
+	response, err := c.do(request, "")
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	closeResponse(response)
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	return distribution.Descriptor{
+		MediaType: mediaType,
+		Size:      response.ContentLength,
+		Digest:    digest.Digest(response.Header.Get("Docker-Content-Digest")),
+	}, nil
+}
+
+// PutManifest associates the manifest, of any supported media type, with the tag or digest in the registry URL.
+func (c *Client) PutManifest(url string, manifest Manifest) error {
+	_, err := c.putManifest(url, manifest)
+	if err != nil {
+		log.Println("failed to PUT manifest", url, err)
+	}
+	return err
+}
+
+// putManifest puts the manifest and returns the response for its headers; the body has already been closed.
+func (c *Client) putManifest(url string, manifest Manifest) (*http.Response, error) {
+	body := string(manifest.Payload)
+	request, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setBody(request, body)
+	setHeader(request, "Content-Type", manifest.MediaType)
+	response, err := c.do(request, body)
+	closeResponse(response)
+	return response, err
+}
+
+// DeleteManifest deletes the manifest at the registry URL, which most registries require to be by digest. Deleting
+// a manifest removes every tag that points at it.
+func (c *Client) DeleteManifest(url string) error {
+	err := c.deleteManifest(url)
+	if err != nil {
+		log.Println("failed to DELETE manifest", url, err)
+	}
+	return err
+}
+
+func (c *Client) deleteManifest(url string) error {
+	request, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.do(request, "")
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// GetImageConfig returns the config of the image at the registry URL. For a multi-platform image the config of its
+// first platform is returned.
+func (c *Client) GetImageConfig(url string) (v1.Image, error) {
+	image, err := c.getImageConfig(url)
+	if err != nil {
+		log.Println("failed to get image config", url, err)
+	}
+	return image, err
+}
+
+func (c *Client) getImageConfig(url string) (v1.Image, error) {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return v1.Image{}, err
+	}
+	manifest, err := c.GetManifest(url)
+	if err != nil {
+		return v1.Image{}, err
+	}
+	if manifest.IsIndex() {
+		entries, err := manifest.indexManifests()
+		if err != nil {
+			return v1.Image{}, err
+		}
+		if len(entries) == 0 {
+			return v1.Image{}, errors.New("empty index " + ref.String())
+		}
+		if manifest, err = c.GetManifest(ref.WithDigest(entries[0].Digest).ManifestURL()); err != nil {
+			return v1.Image{}, err
+		}
+	}
+	im, err := manifest.imageManifest()
+	if err != nil {
+		return v1.Image{}, err
+	}
+	blob, err := c.getVerifiedBlob(ref, im.Config.Digest)
+	if err != nil {
+		return v1.Image{}, err
+	}
+	image := v1.Image{}
+	err = json.Unmarshal(blob, &image)
+	return image, err
+}
+
+// manifestMediaType works out the media type of a manifest, falling back to the mediaType field in the payload when
+// the registry does not send a useful Content-Type header.
+func manifestMediaType(contentType string, payload []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType != "" && mediaType != "application/json" && mediaType != "text/plain" {
+		return mediaType
+	}
+	var versioned struct {
+		SchemaVersion int              `json:"schemaVersion"`
+		MediaType     string           `json:"mediaType"`
+		Signatures    *json.RawMessage `json:"signatures"`
+		Manifests     *json.RawMessage `json:"manifests"`
+	}
+	if json.Unmarshal(payload, &versioned) != nil {
+		return v1.MediaTypeImageManifest
+	}
+	switch {
+	case versioned.MediaType != "":
+		return versioned.MediaType
+	case versioned.SchemaVersion == 1 && versioned.Signatures != nil:
+		return schema1.MediaTypeSignedManifest
+	case versioned.SchemaVersion == 1:
+		return schema1.MediaTypeManifest
+	case versioned.Manifests != nil:
+		return v1.MediaTypeImageIndex
+	}
+	return v1.MediaTypeImageManifest
+}
+
+// imageManifest holds the parts of a single platform image manifest that are common to the schema2 and OCI formats.
+type imageManifest struct {
+	Config distribution.Descriptor
+	Layers []distribution.Descriptor
+}
+
+func (m Manifest) imageManifest() (imageManifest, error) {
+	dm, err := m.Unmarshal()
+	if err != nil {
+		return imageManifest{}, err
+	}
+	switch im := dm.(type) {
+	case *schema2.DeserializedManifest:
+		return imageManifest{Config: im.Config, Layers: im.Layers}, nil
+	case *ocischema.DeserializedManifest:
+		return imageManifest{Config: im.Config, Layers: im.Layers}, nil
+	}
+	return imageManifest{}, errors.New("not an image manifest: " + m.MediaType)
+}
+
+func (m Manifest) indexManifests() ([]manifestlist.ManifestDescriptor, error) {
+	dm, err := m.Unmarshal()
+	if err != nil {
+		return nil, err
+	}
+	list, ok := dm.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return nil, errors.New("not a manifest list or image index: " + m.MediaType)
+	}
+	return list.Manifests, nil
+}
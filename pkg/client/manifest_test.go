@@ -0,0 +1,149 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func manifestResponse(mediaType string, payload string) http.Response {
+	return http.Response{
+		StatusCode: 200,
+		Header:     map[string][]string{"Content-Type": {mediaType}},
+		Body:       ioutil.NopCloser(strings.NewReader(payload)),
+	}
+}
+
+func blobResponse(payload string) http.Response {
+	return http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(payload)),
+	}
+}
+
+func TestGetManifest(t *testing.T) {
+	payload := `{"schemaVersion":2,"mediaType":"` + schema2.MediaTypeManifest + `","config":{},"layers":[]}`
+
+	t.Run("content type", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse(schema2.MediaTypeManifest, payload))}
+		manifest, err := client.GetManifest("http://hello/v2/repo/manifests/latest")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if manifest.MediaType != schema2.MediaTypeManifest || manifest.Digest != digest.FromString(payload) {
+			t.Errorf("unexpected manifest; got %+v", manifest)
+		}
+	})
+
+	t.Run("media type from payload", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse("application/json; charset=utf-8", payload))}
+		manifest, err := client.GetManifest("http://hello/v2/repo/manifests/latest")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if manifest.MediaType != schema2.MediaTypeManifest {
+			t.Errorf("unexpected media type; got %s", manifest.MediaType)
+		}
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		response := manifestResponse(v1.MediaTypeImageManifest, payload)
+		response.Header.Set("Docker-Content-Digest", digest.FromString("other").String())
+		client := Client{client: CreateMockHTTPClient(response)}
+		_, err := client.GetManifest("http://hello/v2/repo/manifests/latest")
+		if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+			t.Errorf("expected digest mismatch; got %s", err)
+		}
+	})
+
+	t.Run("by digest mismatch", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse(v1.MediaTypeImageManifest, payload))}
+		_, err := client.GetManifest("http://hello/v2/repo/manifests/" + digest.FromString("other").String())
+		if err == nil || !strings.Contains(err.Error(), "asked for "+digest.FromString("other").String()) {
+			t.Errorf("expected digest mismatch; got %s", err)
+		}
+	})
+
+	t.Run("status code", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 404})}
+		_, err := client.GetManifest("http://hello/v2/repo/manifests/latest")
+		if err == nil || !strings.Contains(err.Error(), "status code 404") {
+			t.Errorf("expected status code 404; got %s", err)
+		}
+	})
+}
+
+func TestGetVerifiedBlob(t *testing.T) {
+	ref, _ := ParseReference("my.host/repo:latest")
+
+	t.Run("good blob", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(blobResponse("hello"))}
+		blob, err := client.getVerifiedBlob(ref, digest.FromString("hello"))
+		if err != nil || string(blob) != "hello" {
+			t.Errorf("expected hello and nil error; got %s and %s", blob, err)
+		}
+	})
+
+	t.Run("bad blob", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(blobResponse("goodbye"))}
+		_, err := client.getVerifiedBlob(ref, digest.FromString("hello"))
+		if err == nil || !strings.Contains(err.Error(), "blob digest mismatch") {
+			t.Errorf("expected blob digest mismatch; got %s", err)
+		}
+	})
+}
+
+func TestDeleteManifest(t *testing.T) {
+	url := "http://hello/v2/repo/manifests/" + digest.FromString("hello").String()
+
+	t.Run("accepted", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 202, Body: ioutil.NopCloser(strings.NewReader(""))})}
+		if err := client.DeleteManifest(url); err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 405})}
+		err := client.DeleteManifest(url)
+		if err == nil || !strings.Contains(err.Error(), "status code 405") {
+			t.Errorf("expected status code 405; got %s", err)
+		}
+	})
+}
+
+func TestGetImageConfig(t *testing.T) {
+	config := `{"created":"2020-01-02T03:04:05Z","architecture":"amd64","os":"linux"}`
+	image := `{"schemaVersion":2,"mediaType":"` + schema2.MediaTypeManifest + `","config":{"mediaType":"` +
+		schema2.MediaTypeImageConfig + `","digest":"` + digest.FromString(config).String() + `"},"layers":[]}`
+	index := `{"schemaVersion":2,"mediaType":"` + v1.MediaTypeImageIndex + `","manifests":[{"mediaType":"` +
+		schema2.MediaTypeManifest + `","digest":"` + digest.FromString(image).String() + `","platform":{"os":"linux","architecture":"amd64"}}]}`
+
+	t.Run("image", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse(schema2.MediaTypeManifest, image), blobResponse(config))}
+		result, err := client.GetImageConfig("http://hello/v2/repo/manifests/latest")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if result.Created == nil || result.Created.Year() != 2020 || result.Architecture != "amd64" {
+			t.Errorf("unexpected config; got %+v", result)
+		}
+	})
+
+	t.Run("index", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse(v1.MediaTypeImageIndex, index),
+			manifestResponse(schema2.MediaTypeManifest, image), blobResponse(config))}
+		result, err := client.GetImageConfig("http://hello/v2/repo/manifests/latest")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if result.Created == nil || result.Created.Year() != 2020 {
+			t.Errorf("unexpected config; got %+v", result)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ConflictError is returned by PromoteTag when the destination tag doesn't point at the expected digest, either
+// before or after the promotion.
+type ConflictError struct {
+	Reference string
+	Expected  digest.Digest
+	Actual    digest.Digest
+}
+
+func (e ConflictError) Error() string {
+	return "tag " + e.Reference + " has moved - expected " + digestOrNone(e.Expected) + " but found " + digestOrNone(e.Actual)
+}
+
+func digestOrNone(d digest.Digest) string {
+	if d == "" {
+		return "no manifest"
+	}
+	return d.String()
+}
+
+// IsConflict reports whether the error is a ConflictError.
+func IsConflict(err error) bool {
+	_, ok := err.(ConflictError)
+	return ok
+}
+
+// PromoteTag points the destination tag at the manifest of the source, provided the destination currently points at
+// expectedDstDigest, or doesn't exist if expectedDstDigest is empty. Sources and destinations may be registry manifest
+// URLs or Docker style image names.
+//
+// The destination is checked before the manifest is put, the put is made conditional with If-Match for registries
+// that support it, and the destination is checked again afterwards. A ConflictError is returned if the destination
+// moved underneath us at any point. Promoting to a destination that already has the source's digest succeeds.
+func (c *Client) PromoteTag(src string, dst string, expectedDstDigest digest.Digest) error {
+	err := c.promoteTag(src, dst, expectedDstDigest)
+	if err != nil {
+		log.Println("failed to promote tag", src, dst, err)
+	}
+	return err
+}
+
+func (c *Client) promoteTag(src string, dst string, expected digest.Digest) error {
+	srcRef, err := ParseReference(src)
+	if err != nil {
+		return err
+	}
+	dstRef, err := ParseReference(dst)
+	if err != nil {
+		return err
+	}
+	manifest, err := c.GetManifest(srcRef.ManifestURL())
+	if err != nil {
+		return err
+	}
+	current, err := c.currentDigest(dstRef)
+	if err != nil {
+		return err
+	}
+	if current == manifest.Digest {
+		return nil
+	}
+	if current != expected {
+		return ConflictError{Reference: dstRef.String(), Expected: expected, Actual: current}
+	}
+	body := string(manifest.Payload)
+	request, err := http.NewRequest("PUT", dstRef.ManifestURL(), nil)
+	if err != nil {
+		return err
+	}
+	setBody(request, body)
+	setHeader(request, "Content-Type", manifest.MediaType)
+	if expected == "" {
+		setHeader(request, "If-None-Match", "*")
+	} else {
+		setHeader(request, "If-Match", `"`+expected.String()+`"`)
+	}
+	response, err := c.do(request, body)
+	if statusErr, ok := err.(StatusError); ok && statusErr.StatusCode == 412 {
+		current, _ = c.currentDigest(dstRef)
+		return ConflictError{Reference: dstRef.String(), Expected: expected, Actual: current}
+	}
+	if err != nil {
+		return err
+	}
+	if response.Body != nil {
+		response.Body.Close()
+	}
+	// registries that ignore If-Match leave a window between the check and the put, so check what was written
+	if current, err = c.currentDigest(dstRef); err != nil {
+		return err
+	}
+	if current != manifest.Digest {
+		return ConflictError{Reference: dstRef.String(), Expected: manifest.Digest, Actual: current}
+	}
+	return nil
+}
+
+// currentDigest returns the digest the tag points at, or an empty digest if there is no such tag.
+func (c *Client) currentDigest(ref Reference) (digest.Digest, error) {
+	descriptor, err := c.HeadManifest(ref.ManifestURL())
+	if IsNotFound(err) {
+		return "", nil
+	}
+	if err == nil && descriptor.Digest == "" {
+		var manifest Manifest
+		manifest, err = c.GetManifest(ref.ManifestURL())
+		descriptor.Digest = manifest.Digest
+	}
+	return descriptor.Digest, err
+}
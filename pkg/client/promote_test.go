@@ -0,0 +1,69 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestPromoteTag(t *testing.T) {
+	payload := `{"schemaVersion":2,"mediaType":"` + schema2.MediaTypeManifest + `","config":{},"layers":[]}`
+	promoted := digest.FromString(payload)
+	old := digest.FromString("old")
+	other := digest.FromString("other")
+	head := func(d digest.Digest) http.Response {
+		return http.Response{StatusCode: 200, Header: http.Header{"Docker-Content-Digest": {d.String()}}}
+	}
+	src := "my.host/repo:rc"
+	dst := "my.host/repo:stable"
+
+	for name, test := range map[string]struct {
+		responses []http.Response
+		expected  digest.Digest
+		conflict  bool
+	}{
+		"promoted":          {[]http.Response{head(old), {StatusCode: 201}, head(promoted)}, old, false},
+		"new tag":           {[]http.Response{{StatusCode: 404}, {StatusCode: 201}, head(promoted)}, "", false},
+		"already promoted":  {[]http.Response{head(promoted)}, old, false},
+		"moved before":      {[]http.Response{head(other)}, old, true},
+		"unexpected tag":    {[]http.Response{head(other)}, "", true},
+		"precondition":      {[]http.Response{head(old), {StatusCode: 412}, head(other)}, old, true},
+		"overwritten after": {[]http.Response{head(old), {StatusCode: 201}, head(other)}, old, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			responses := append([]http.Response{manifestResponse(schema2.MediaTypeManifest, payload)}, test.responses...)
+			client := Client{client: CreateMockHTTPClient(responses...)}
+			err := client.PromoteTag(src, dst, test.expected)
+			if test.conflict && !IsConflict(err) {
+				t.Errorf("expected a conflict; got %v", err)
+			}
+			if !test.conflict && err != nil {
+				t.Errorf("expected nil error; got %s", err)
+			}
+		})
+	}
+
+	t.Run("conflict message", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(manifestResponse(schema2.MediaTypeManifest, payload), head(other))}
+		err := client.PromoteTag(src, dst, "")
+		expected := "tag my.host/repo:stable has moved - expected no manifest but found " + other.String()
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected %s; got %v", expected, err)
+		}
+	})
+
+	t.Run("conditional put", func(t *testing.T) {
+		mock := CreateScriptedHTTPClient(t,
+			Expectation{Method: "GET", Path: "/v2/repo/manifests/rc", ResponseHeader: http.Header{"Content-Type": {schema2.MediaTypeManifest}}, Body: payload},
+			Expectation{Method: "HEAD", Path: "/v2/repo/manifests/stable", ResponseHeader: http.Header{"Docker-Content-Digest": {old.String()}}},
+			Expectation{Method: "PUT", Path: "/v2/repo/manifests/stable", Header: http.Header{"If-Match": {`"` + old.String() + `"`}}, StatusCode: 201},
+			Expectation{Method: "HEAD", Path: "/v2/repo/manifests/stable", ResponseHeader: http.Header{"Docker-Content-Digest": {promoted.String()}}},
+		)
+		client := Client{client: mock}
+		if err := client.PromoteTag(src, dst, old); err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	defaultHost = "registry-1.docker.io"
+	defaultTag  = "latest"
+)
+
+// Reference identifies a repository in a Docker registry and, optionally, a tag or digest within it.
+type Reference struct {
+	Scheme     string
+	Host       string
+	Repository string
+	Tag        string
+	Digest     digest.Digest
+}
+
+// ParseReference parses either a registry manifest URL, such as https://my.host/v2/my/repo/manifests/latest, or a
+// Docker style image name, such as my.host/my/repo:latest or my.host/my/repo@sha256:..., into a Reference.
+func ParseReference(ref string) (Reference, error) {
+	if strings.Contains(ref, "://") {
+		return parseManifestURL(ref)
+	}
+	return parseImageName(ref)
+}
+
+func parseManifestURL(ref string) (Reference, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return Reference{}, err
+	}
+	path := strings.TrimPrefix(u.Path, "/v2/")
+	i := strings.LastIndex(path, "/manifests/")
+	if path == u.Path || i <= 0 {
+		return Reference{}, errors.New("not a manifest URL: " + ref)
+	}
+	r := Reference{Scheme: u.Scheme, Host: u.Host, Repository: path[:i]}
+	return r.withTagOrDigest(path[i+len("/manifests/"):])
+}
+
+func parseImageName(ref string) (Reference, error) {
+	r := Reference{Scheme: "https", Host: defaultHost}
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		d, err := digest.Parse(name[i+1:])
+		if err != nil {
+			return Reference{}, err
+		}
+		r.Digest = d
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		r.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.Index(name, "/"); i > 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			r.Host = first
+			name = name[i+1:]
+		}
+	}
+	if r.Host == defaultHost && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	if name == "" {
+		return Reference{}, errors.New("no repository in image name: " + ref)
+	}
+	r.Repository = name
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = defaultTag
+	}
+	return r, nil
+}
+
+func (r Reference) withTagOrDigest(tagOrDigest string) (Reference, error) {
+	if tagOrDigest == "" {
+		return Reference{}, errors.New("no tag or digest in reference")
+	}
+	if strings.Contains(tagOrDigest, ":") {
+		d, err := digest.Parse(tagOrDigest)
+		if err != nil {
+			return Reference{}, err
+		}
+		r.Digest = d
+	} else {
+		r.Tag = tagOrDigest
+	}
+	return r, nil
+}
+
+// WithDigest returns a copy of the Reference that points at the given digest rather than a tag.
+func (r Reference) WithDigest(d digest.Digest) Reference {
+	r.Tag = ""
+	r.Digest = d
+	return r
+}
+
+// WithTag returns a copy of the Reference that points at the given tag rather than a digest.
+func (r Reference) WithTag(tag string) Reference {
+	r.Tag = tag
+	r.Digest = ""
+	return r
+}
+
+func (r Reference) repositoryURL() string {
+	return r.Scheme + "://" + r.Host + "/v2/" + r.Repository
+}
+
+// ManifestURL returns the URL of the manifest the Reference points at, preferring the digest over the tag.
+func (r Reference) ManifestURL() string {
+	if r.Digest != "" {
+		return r.repositoryURL() + "/manifests/" + r.Digest.String()
+	}
+	return r.repositoryURL() + "/manifests/" + r.Tag
+}
+
+// BlobURL returns the URL of the blob with the given digest in the Reference's repository.
+func (r Reference) BlobURL(d digest.Digest) string {
+	return r.repositoryURL() + "/blobs/" + d.String()
+}
+
+// String returns the Reference as a Docker style image name.
+func (r Reference) String() string {
+	s := r.Host + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest.String()
+	}
+	return s
+}
+
+// familiarName returns the repository name as docker shows it, which leaves out the host and library/ prefix of
+// Docker Hub images, so registry-1.docker.io/library/alpine is alpine.
+func (r Reference) familiarName() string {
+	if r.Host != defaultHost && r.Host != "docker.io" && r.Host != "index.docker.io" {
+		return r.Host + "/" + r.Repository
+	}
+	return strings.TrimPrefix(r.Repository, "library/")
+}
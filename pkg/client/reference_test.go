@@ -0,0 +1,89 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestParseReference(t *testing.T) {
+	t.Run("manifest url with tag", func(t *testing.T) {
+		ref, err := ParseReference("https://my.host:5000/v2/my/repo/manifests/v1")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if ref.Scheme != "https" || ref.Host != "my.host:5000" || ref.Repository != "my/repo" || ref.Tag != "v1" || ref.Digest != "" {
+			t.Errorf("unexpected reference; got %+v", ref)
+		}
+	})
+	t.Run("manifest url with digest", func(t *testing.T) {
+		ref, err := ParseReference("http://my.host/v2/repo/manifests/sha256:" + strings.Repeat("a", 64))
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if ref.Tag != "" || ref.Digest.Hex() != strings.Repeat("a", 64) {
+			t.Errorf("unexpected reference; got %+v", ref)
+		}
+	})
+	t.Run("not a manifest url", func(t *testing.T) {
+		_, err := ParseReference("https://my.host/v2/repo/blobs/abc")
+		if err == nil || !strings.Contains(err.Error(), "not a manifest URL") {
+			t.Errorf("expected not a manifest URL; got %s", err)
+		}
+	})
+	t.Run("bad digest", func(t *testing.T) {
+		_, err := ParseReference("my.host/repo@sha256:abc")
+		if err == nil {
+			t.Error("expected non nil error")
+		}
+	})
+	t.Run("image name", func(t *testing.T) {
+		ref, err := ParseReference("localhost:5000/my/repo:v2")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if ref.Scheme != "https" || ref.Host != "localhost:5000" || ref.Repository != "my/repo" || ref.Tag != "v2" {
+			t.Errorf("unexpected reference; got %+v", ref)
+		}
+		if ref.ManifestURL() != "https://localhost:5000/v2/my/repo/manifests/v2" {
+			t.Errorf("unexpected manifest url; got %s", ref.ManifestURL())
+		}
+	})
+	t.Run("docker hub defaults", func(t *testing.T) {
+		ref, err := ParseReference("busybox")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if ref.String() != "registry-1.docker.io/library/busybox:latest" {
+			t.Errorf("unexpected reference; got %s", ref)
+		}
+	})
+	t.Run("with digest", func(t *testing.T) {
+		ref, _ := ParseReference("my.host/repo:v1")
+		d := ref.WithDigest(digest.Digest("sha256:" + strings.Repeat("b", 64)))
+		if d.Tag != "" || !strings.HasSuffix(d.ManifestURL(), "/manifests/sha256:"+strings.Repeat("b", 64)) {
+			t.Errorf("unexpected reference; got %+v", d)
+		}
+		if d.BlobURL(d.Digest) != "https://my.host/v2/repo/blobs/sha256:"+strings.Repeat("b", 64) {
+			t.Errorf("unexpected blob url; got %s", d.BlobURL(d.Digest))
+		}
+	})
+}
+
+func TestFamiliarName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"alpine":                "alpine",
+		"docker.io/org/app":     "org/app",
+		"my.host:5000/org/app":  "my.host:5000/org/app",
+		"my.host/library/thing": "my.host/library/thing",
+	} {
+		ref, err := ParseReference(name)
+		if err != nil {
+			t.Fatalf("%s: expected nil error; got %s", name, err)
+		}
+		if familiar := ref.familiarName(); familiar != expected {
+			t.Errorf("%s: expected %s; got %s", name, expected, familiar)
+		}
+	}
+}
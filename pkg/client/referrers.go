@@ -0,0 +1,138 @@
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ListReferrers returns the descriptors of the manifests in the repository of repo whose subject is the manifest with
+// the given digest, such as signatures and SBOMs. If artifactType is not empty only referrers of that type are
+// returned. Registries that do not implement the referrers API are handled by reading the referrers tag schema
+// instead, i.e. the index tagged with the subject digest as <alg>-<hex>.
+func (c *Client) ListReferrers(repo Reference, subject digest.Digest, artifactType string) ([]v1.Descriptor, error) {
+	referrers, err := c.listReferrers(repo, subject, artifactType)
+	if IsNotFound(err) {
+		referrers, err = c.listReferrersTag(repo, subject, artifactType)
+	}
+	if err != nil {
+		log.Println("failed to list referrers", repo.WithDigest(subject), err)
+	}
+	return referrers, err
+}
+
+// ListReferrersFromAPI is ListReferrers without the referrers tag schema fallback: it only asks the referrers API,
+// so a registry that doesn't implement the API results in a StatusError, usually for a 404.
+func (c *Client) ListReferrersFromAPI(repo Reference, subject digest.Digest, artifactType string) ([]v1.Descriptor, error) {
+	referrers, err := c.listReferrers(repo, subject, artifactType)
+	if err != nil {
+		log.Println("failed to list referrers from the referrers API", repo.WithDigest(subject), err)
+	}
+	return referrers, err
+}
+
+func (c *Client) listReferrers(repo Reference, subject digest.Digest, artifactType string) ([]v1.Descriptor, error) {
+	if err := subject.Validate(); err != nil {
+		return nil, err
+	}
+	queryURL := repo.repositoryURL() + "/referrers/" + subject.String()
+	if artifactType != "" {
+		queryURL += "?" + url.Values{"artifactType": []string{artifactType}}.Encode()
+	}
+	var referrers []v1.Descriptor
+	for queryURL != "" {
+		request, err := http.NewRequest("GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		setHeader(request, "Accept", v1.MediaTypeImageIndex)
+		response, err := c.do(request, "")
+		if err != nil {
+			return nil, err
+		}
+		index := v1.Index{}
+		err = json.NewDecoder(response.Body).Decode(&index)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		filtered := strings.Contains(response.Header.Get("OCI-Filters-Applied"), "artifactType")
+		for _, descriptor := range index.Manifests {
+			if filtered || artifactType == "" || descriptor.ArtifactType == artifactType {
+				referrers = append(referrers, descriptor)
+			}
+		}
+		queryURL, err = nextLink(request.URL, response.Header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return referrers, nil
+}
+
+// listReferrersTag reads the referrers from the fallback index, returning none if the tag doesn't exist.
+func (c *Client) listReferrersTag(repo Reference, subject digest.Digest, artifactType string) ([]v1.Descriptor, error) {
+	index, err := c.getReferrersTagIndex(repo, subject)
+	if err != nil {
+		return nil, err
+	}
+	var referrers []v1.Descriptor
+	for _, descriptor := range index.Manifests {
+		if artifactType == "" || descriptor.ArtifactType == artifactType {
+			referrers = append(referrers, descriptor)
+		}
+	}
+	return referrers, nil
+}
+
+// getReferrersTagIndex returns the fallback referrers index for the subject, which is empty if the tag doesn't exist.
+func (c *Client) getReferrersTagIndex(repo Reference, subject digest.Digest) (v1.Index, error) {
+	index := v1.Index{}
+	if err := subject.Validate(); err != nil {
+		return index, err
+	}
+	manifest, err := c.getManifest(repo.WithTag(referrersTag(subject)).ManifestURL())
+	if IsNotFound(err) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	err = json.Unmarshal(manifest.Payload, &index)
+	return index, err
+}
+
+// referrersTag returns the tag used by the referrers tag schema for the subject digest.
+func referrersTag(subject digest.Digest) string {
+	return subject.Algorithm().String() + "-" + subject.Hex()
+}
+
+// nextLink returns the absolute URL of the next page from an RFC 5988 Link header, or an empty string if there is no
+// next page.
+func nextLink(base *url.URL, header http.Header) (string, error) {
+	for _, link := range header["Link"] {
+		for _, value := range strings.Split(link, ",") {
+			parts := strings.Split(value, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+				if param == `rel="next"` || param == "rel=next" {
+					next, err := base.Parse(strings.Trim(target, "<>"))
+					if err != nil {
+						return "", err
+					}
+					return next.String(), nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func referrersIndex(artifactTypes ...string) string {
+	var manifests []string
+	for _, artifactType := range artifactTypes {
+		manifests = append(manifests, `{"mediaType":"`+v1.MediaTypeImageManifest+`","digest":"`+digest.FromString(artifactType).String()+
+			`","size":1,"artifactType":"`+artifactType+`","annotations":{"type":"`+artifactType+`"}}`)
+	}
+	return `{"schemaVersion":2,"mediaType":"` + v1.MediaTypeImageIndex + `","manifests":[` + strings.Join(manifests, ",") + `]}`
+}
+
+func TestListReferrers(t *testing.T) {
+	repo, _ := ParseReference("http://hello/v2/repo/manifests/latest")
+	subject := digest.FromString("subject")
+
+	t.Run("pages", func(t *testing.T) {
+		first := manifestResponse(v1.MediaTypeImageIndex, referrersIndex("sbom", "signature"))
+		first.Header.Set("Link", `</v2/repo/referrers/`+subject.String()+`?n=2&last=b>; rel="next"`)
+		client := Client{client: CreateMockHTTPClient(first, manifestResponse(v1.MediaTypeImageIndex, referrersIndex("sbom")))}
+		referrers, err := client.ListReferrers(repo, subject, "sbom")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if len(referrers) != 2 || referrers[0].ArtifactType != "sbom" || referrers[1].Annotations["type"] != "sbom" {
+			t.Errorf("expected two sbom referrers; got %+v", referrers)
+		}
+	})
+
+	t.Run("filters applied", func(t *testing.T) {
+		response := manifestResponse(v1.MediaTypeImageIndex, referrersIndex("sbom", "signature"))
+		response.Header.Set("OCI-Filters-Applied", "artifactType")
+		client := Client{client: CreateMockHTTPClient(response)}
+		referrers, err := client.ListReferrers(repo, subject, "sbom")
+		if err != nil || len(referrers) != 2 {
+			t.Errorf("expected the registry's filtering to be trusted; got %+v and %s", referrers, err)
+		}
+	})
+
+	t.Run("tag fallback", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			http.Response{StatusCode: 404},
+			manifestResponse(v1.MediaTypeImageIndex, referrersIndex("sbom", "signature")),
+		)}
+		referrers, err := client.ListReferrers(repo, subject, "signature")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if len(referrers) != 1 || referrers[0].Digest != digest.FromString("signature") {
+			t.Errorf("expected one signature referrer; got %+v", referrers)
+		}
+	})
+
+	t.Run("no fallback tag", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 404})}
+		referrers, err := client.ListReferrers(repo, subject, "")
+		if err != nil || len(referrers) != 0 {
+			t.Errorf("expected no referrers and nil error; got %+v and %s", referrers, err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 500})}
+		_, err := client.ListReferrers(repo, subject, "")
+		if err == nil || !strings.Contains(err.Error(), "status code 500") {
+			t.Errorf("expected status code 500; got %s", err)
+		}
+	})
+}
+
+func TestListReferrersFromAPI(t *testing.T) {
+	repo, _ := ParseReference("http://hello/v2/repo/manifests/latest")
+	subject := digest.FromString("subject")
+
+	t.Run("accepts an index", func(t *testing.T) {
+		client := Client{client: CreateScriptedHTTPClient(t, Expectation{
+			Method:     "GET",
+			Path:       "/v2/repo/referrers/" + subject.String(),
+			Query:      url.Values{"artifactType": {"sbom"}},
+			Header:     http.Header{"Accept": {v1.MediaTypeImageIndex}},
+			StatusCode: 200,
+			Body:       referrersIndex("sbom"),
+		})}
+		referrers, err := client.ListReferrersFromAPI(repo, subject, "sbom")
+		if err != nil || len(referrers) != 1 || referrers[0].ArtifactType != "sbom" {
+			t.Errorf("expected one sbom referrer; got %+v and %s", referrers, err)
+		}
+	})
+
+	t.Run("no fallback", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 404})}
+		_, err := client.ListReferrersFromAPI(repo, subject, "")
+		if !IsNotFound(err) {
+			t.Errorf("expected not found error; got %s", err)
+		}
+	})
+}
+
+func TestReferrersTag(t *testing.T) {
+	subject := digest.FromString("subject")
+	if referrersTag(subject) != "sha256-"+subject.Hex() {
+		t.Errorf("unexpected tag; got %s", referrersTag(subject))
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	base, _ := url.Parse("https://my.host/v2/_catalog")
+	t.Run("no link", func(t *testing.T) {
+		next, err := nextLink(base, http.Header{})
+		if next != "" || err != nil {
+			t.Errorf("expected no next link; got %s and %s", next, err)
+		}
+	})
+	t.Run("relative link", func(t *testing.T) {
+		next, err := nextLink(base, http.Header{"Link": {`</v2/_catalog?last=b&n=2>; rel="next"`}})
+		if next != "https://my.host/v2/_catalog?last=b&n=2" || err != nil {
+			t.Errorf("expected absolute next link; got %s and %s", next, err)
+		}
+	})
+	t.Run("other rel", func(t *testing.T) {
+		next, _ := nextLink(base, http.Header{"Link": {`<https://elsewhere>; rel="prev"`}})
+		if next != "" {
+			t.Errorf("expected no next link; got %s", next)
+		}
+	})
+}
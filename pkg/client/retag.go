@@ -0,0 +1,158 @@
+package client
+
+import (
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"gopkg.in/yaml.v2"
+)
+
+// RetagMapping lists the targets that a source image should be tagged as. Sources and targets may be registry manifest
+// URLs or Docker style image names. Targets must be in a repository that already holds the source's blobs.
+type RetagMapping struct {
+	Source  string   `json:"source" yaml:"source"`
+	Targets []string `json:"targets" yaml:"targets"`
+}
+
+// RetagStatus is the outcome of retagging a single target.
+type RetagStatus string
+
+const (
+	// Retagged means the target now points at the source's manifest.
+	Retagged RetagStatus = "retagged"
+	// Unchanged means the target already pointed at the source's manifest.
+	Unchanged RetagStatus = "unchanged"
+	// RetagFailed means the target could not be retagged.
+	RetagFailed RetagStatus = "failed"
+)
+
+// RetagResult is the outcome of retagging a single target.
+type RetagResult struct {
+	Target string
+	Status RetagStatus
+	Err    error
+}
+
+// RetagReport is the outcome of a RetagMapping. Err is set if the source could not be resolved, in which case no
+// targets were attempted.
+type RetagReport struct {
+	Source  string
+	Digest  digest.Digest
+	Results []RetagResult
+	Err     error
+}
+
+// LoadRetagMappings reads a list of RetagMappings from a YAML or JSON file.
+func LoadRetagMappings(path string) ([]RetagMapping, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []RetagMapping
+	err = yaml.Unmarshal(content, &mappings)
+	return mappings, err
+}
+
+// Retag points the targets of every mapping at the manifest of its source, making up to concurrency requests at once.
+// Each distinct source is fetched once, and targets that already have the source's digest are left alone. It returns
+// a report for each mapping, in the same order as the mappings.
+func (c *Client) Retag(mappings []RetagMapping, concurrency int) []RetagReport {
+	sources := make(map[string]*RetagReport)
+	var order []string
+	for _, mapping := range mappings {
+		if _, exists := sources[mapping.Source]; !exists {
+			sources[mapping.Source] = &RetagReport{Source: mapping.Source}
+			order = append(order, mapping.Source)
+		}
+	}
+	manifests := make(map[string]Manifest)
+	var mutex sync.Mutex
+	parallel(concurrency, len(order), func(i int) {
+		manifest, err := c.resolveRetagSource(order[i])
+		mutex.Lock()
+		defer mutex.Unlock()
+		sources[order[i]].Digest = manifest.Digest
+		sources[order[i]].Err = err
+		manifests[order[i]] = manifest
+	})
+	reports := make([]RetagReport, len(mappings))
+	type job struct {
+		mapping int
+		target  int
+	}
+	var jobs []job
+	for i, mapping := range mappings {
+		source := sources[mapping.Source]
+		reports[i] = RetagReport{Source: mapping.Source, Digest: source.Digest, Err: source.Err}
+		if source.Err != nil {
+			continue
+		}
+		reports[i].Results = make([]RetagResult, len(mapping.Targets))
+		for j := range mapping.Targets {
+			jobs = append(jobs, job{mapping: i, target: j})
+		}
+	}
+	parallel(concurrency, len(jobs), func(i int) {
+		mapping := mappings[jobs[i].mapping]
+		target := mapping.Targets[jobs[i].target]
+		status, err := c.retag(manifests[mapping.Source], target)
+		if err != nil {
+			log.Println("failed to retag", mapping.Source, target, err)
+		}
+		reports[jobs[i].mapping].Results[jobs[i].target] = RetagResult{Target: target, Status: status, Err: err}
+	})
+	return reports
+}
+
+func (c *Client) resolveRetagSource(source string) (Manifest, error) {
+	ref, err := ParseReference(source)
+	if err != nil {
+		log.Println("failed to resolve retag source", source, err)
+		return Manifest{}, err
+	}
+	return c.GetManifest(ref.ManifestURL())
+}
+
+// retag puts the manifest to the target unless a HEAD request shows it is already there.
+func (c *Client) retag(manifest Manifest, target string) (RetagStatus, error) {
+	ref, err := ParseReference(target)
+	if err != nil {
+		return RetagFailed, err
+	}
+	descriptor, err := c.HeadManifest(ref.ManifestURL())
+	if err == nil && descriptor.Digest == manifest.Digest {
+		return Unchanged, nil
+	}
+	if err != nil && !IsNotFound(err) {
+		return RetagFailed, err
+	}
+	if _, err = c.putManifest(ref.ManifestURL(), manifest); err != nil {
+		return RetagFailed, err
+	}
+	return Retagged, nil
+}
+
+// parallel calls f for each index from 0 to count - 1, running up to concurrency calls at once.
+func parallel(concurrency int, count int, f func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
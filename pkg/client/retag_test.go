@@ -0,0 +1,82 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestRetag(t *testing.T) {
+	payload := `{"schemaVersion":2,"mediaType":"` + schema2.MediaTypeManifest + `","config":{},"layers":[]}`
+	d := digest.FromString(payload)
+
+	t.Run("targets", func(t *testing.T) {
+		existing := http.Response{StatusCode: 200, Header: http.Header{"Docker-Content-Digest": {d.String()}}}
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, payload),
+			existing,
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 201},
+		)}
+		reports := client.Retag([]RetagMapping{{Source: "my.host/repo:a", Targets: []string{"my.host/repo:b", "my.host/repo:c"}}}, 1)
+		if len(reports) != 1 || reports[0].Err != nil || reports[0].Digest != d {
+			t.Fatalf("expected a report for %s; got %+v", d, reports)
+		}
+		results := reports[0].Results
+		if len(results) != 2 || results[0].Status != Unchanged || results[1].Status != Retagged {
+			t.Errorf("expected b unchanged and c retagged; got %+v", results)
+		}
+	})
+
+	t.Run("bad source", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 404})}
+		reports := client.Retag([]RetagMapping{
+			{Source: "my.host/repo:a", Targets: []string{"my.host/repo:b"}},
+			{Source: "my.host/repo:a", Targets: []string{"my.host/repo:c"}},
+		}, 4)
+		if len(reports) != 2 || !IsNotFound(reports[0].Err) || !IsNotFound(reports[1].Err) || reports[1].Results != nil {
+			t.Errorf("expected not found for both mappings; got %+v", reports)
+		}
+	})
+
+	t.Run("bad target", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema2.MediaTypeManifest, payload),
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 400},
+		)}
+		reports := client.Retag([]RetagMapping{{Source: "my.host/repo:a", Targets: []string{"my.host/other:b"}}}, 1)
+		if result := reports[0].Results[0]; result.Status != RetagFailed || result.Err == nil {
+			t.Errorf("expected failure; got %+v", result)
+		}
+	})
+}
+
+func TestLoadRetagMappings(t *testing.T) {
+	dir := createTempDir(t)
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"mappings.yaml": "- source: my.host/repo:a\n  targets: [my.host/repo:b, my.host/repo:c]\n",
+		"mappings.json": `[{"source":"my.host/repo:a","targets":["my.host/repo:b","my.host/repo:c"]}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			mappings, err := LoadRetagMappings(path)
+			if err != nil {
+				t.Fatalf("expected nil error; got %s", err)
+			}
+			if len(mappings) != 1 || mappings[0].Source != "my.host/repo:a" || len(mappings[0].Targets) != 2 {
+				t.Errorf("unexpected mappings; got %+v", mappings)
+			}
+		})
+	}
+}
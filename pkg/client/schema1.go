@@ -0,0 +1,218 @@
+package client
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// IsSchema1 reports whether the manifest is a legacy signed or unsigned schema1 manifest.
+func (m Manifest) IsSchema1() bool {
+	return m.MediaType == schema1.MediaTypeSignedManifest || m.MediaType == schema1.MediaTypeManifest
+}
+
+// schema1Manifest decodes a schema1 manifest and returns it along with its canonical bytes, which for a signed
+// manifest are the payload with the JWS signatures stripped.
+func (m Manifest) schema1Manifest() (schema1.Manifest, []byte, error) {
+	if m.MediaType == schema1.MediaTypeSignedManifest {
+		signed := &schema1.SignedManifest{}
+		if err := signed.UnmarshalJSON(m.Payload); err != nil {
+			return schema1.Manifest{}, nil, err
+		}
+		return signed.Manifest, signed.Canonical, nil
+	}
+	var manifest schema1.Manifest
+	err := json.Unmarshal(m.Payload, &manifest)
+	return manifest, m.Payload, err
+}
+
+// manifestDigest returns the digest a registry gives to a manifest payload, which is the digest of the canonical
+// bytes for signed schema1 manifests and the digest of the payload itself for everything else.
+func manifestDigest(mediaType string, payload []byte) (digest.Digest, error) {
+	if mediaType != schema1.MediaTypeSignedManifest {
+		return digest.FromBytes(payload), nil
+	}
+	_, canonical, err := Manifest{MediaType: mediaType, Payload: payload}.schema1Manifest()
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(canonical), nil
+}
+
+// v1Compatibility holds the fields of a schema1 history entry that are needed to build a schema2 config.
+type v1Compatibility struct {
+	Created         time.Time `json:"created"`
+	Author          string    `json:"author,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+	ThrowAway       bool      `json:"throwaway,omitempty"`
+	ContainerConfig struct {
+		Cmd []string `json:"Cmd"`
+	} `json:"container_config"`
+}
+
+// ConvertSchema1 fetches the schema1 manifest at the registry URL and converts it into a manifest of the given
+// media type, which must be the schema2 or OCI image manifest type. The image config is synthesized from the schema1
+// history and pushed to the same repository, so the returned manifest can then be put to any tag in that repository.
+func (c *Client) ConvertSchema1(url string, mediaType string) (Manifest, error) {
+	ref, err := ParseReference(url)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var configMediaType, layerMediaType string
+	switch mediaType {
+	case schema2.MediaTypeManifest:
+		configMediaType, layerMediaType = schema2.MediaTypeImageConfig, schema2.MediaTypeLayer
+	case v1.MediaTypeImageManifest:
+		configMediaType, layerMediaType = v1.MediaTypeImageConfig, v1.MediaTypeImageLayerGzip
+	default:
+		return Manifest{}, errors.New("cannot convert schema1 manifest to " + mediaType)
+	}
+	manifest, err := c.GetManifest(url)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if !manifest.IsSchema1() {
+		return Manifest{}, errors.New("not a schema1 manifest: " + manifest.MediaType)
+	}
+	s1, _, err := manifest.schema1Manifest()
+	if err != nil {
+		return Manifest{}, err
+	}
+	if len(s1.History) == 0 || len(s1.History) != len(s1.FSLayers) {
+		return Manifest{}, errors.New("schema1 manifest has mismatched history and layers")
+	}
+	// schema1 lists the newest layer first, whereas schema2 and OCI list the base layer first
+	var layers []distribution.Descriptor
+	var diffIDs []digest.Digest
+	var history []v1.History
+	for i := len(s1.History) - 1; i >= 0; i-- {
+		var compat v1Compatibility
+		if err = json.Unmarshal([]byte(s1.History[i].V1Compatibility), &compat); err != nil {
+			return Manifest{}, err
+		}
+		created := compat.Created
+		history = append(history, v1.History{
+			Created:    &created,
+			CreatedBy:  strings.Join(compat.ContainerConfig.Cmd, " "),
+			Author:     compat.Author,
+			Comment:    compat.Comment,
+			EmptyLayer: compat.ThrowAway,
+		})
+		if compat.ThrowAway {
+			continue
+		}
+		layer, diffID, err := c.describeLayer(ref, s1.FSLayers[i].BlobSum)
+		if err != nil {
+			return Manifest{}, err
+		}
+		layer.MediaType = layerMediaType
+		layers = append(layers, layer)
+		diffIDs = append(diffIDs, diffID)
+	}
+	config, err := schema1Config(s1.History[0].V1Compatibility, diffIDs, history)
+	if err != nil {
+		return Manifest{}, err
+	}
+	configDescriptor, err := c.PutBlob(ref, configMediaType, config)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var converted distribution.Manifest
+	if mediaType == schema2.MediaTypeManifest {
+		converted, err = schema2.FromStruct(schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    configDescriptor,
+			Layers:    layers,
+		})
+	} else {
+		converted, err = ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    configDescriptor,
+			Layers:    layers,
+		})
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	_, payload, err := converted.Payload()
+	if err != nil {
+		return Manifest{}, err
+	}
+	return Manifest{MediaType: mediaType, Digest: digest.FromBytes(payload), Payload: payload}, nil
+}
+
+// describeLayer reads a gzipped layer blob, verifying it against its digest, and returns its descriptor along with
+// the digest of the uncompressed content, which schema2 configs use as the layer's diff ID.
+func (c *Client) describeLayer(ref Reference, d digest.Digest) (distribution.Descriptor, digest.Digest, error) {
+	if err := d.Validate(); err != nil {
+		return distribution.Descriptor{}, "", err
+	}
+	reader, err := c.openBlob(ref.BlobURL(d))
+	if err != nil {
+		return distribution.Descriptor{}, "", err
+	}
+	defer reader.Close()
+	compressed := d.Algorithm().Digester()
+	counter := &countingWriter{}
+	gz, err := gzip.NewReader(io.TeeReader(reader, io.MultiWriter(compressed.Hash(), counter)))
+	if err != nil {
+		return distribution.Descriptor{}, "", err
+	}
+	uncompressed := digest.Canonical.Digester()
+	if _, err = io.Copy(uncompressed.Hash(), gz); err != nil {
+		return distribution.Descriptor{}, "", err
+	}
+	// drain any trailing bytes after the gzip stream so that the compressed digest covers the whole blob
+	if _, err = io.Copy(ioutil.Discard, io.TeeReader(reader, io.MultiWriter(compressed.Hash(), counter))); err != nil {
+		return distribution.Descriptor{}, "", err
+	}
+	if compressed.Digest() != d {
+		return distribution.Descriptor{}, "", errors.New("blob digest mismatch - expected " + d.String())
+	}
+	return distribution.Descriptor{Digest: d, Size: counter.n}, uncompressed.Digest(), nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// schema1Config builds a schema2 image config from the v1 compatibility JSON of the newest schema1 history entry.
+func schema1Config(compat string, diffIDs []digest.Digest, history []v1.History) ([]byte, error) {
+	config := make(map[string]*json.RawMessage)
+	if err := json.Unmarshal([]byte(compat), &config); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"id", "parent", "Size", "parent_id", "layer_id", "throwaway"} {
+		delete(config, key)
+	}
+	if diffIDs == nil {
+		diffIDs = []digest.Digest{}
+	}
+	rootFS, err := json.Marshal(v1.RootFS{Type: "layers", DiffIDs: diffIDs})
+	if err != nil {
+		return nil, err
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+	config["rootfs"] = (*json.RawMessage)(&rootFS)
+	config["history"] = (*json.RawMessage)(&historyJSON)
+	return json.Marshal(config)
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+)
+
+func testSchema1Manifest(history []string, layers ...digest.Digest) schema1.Manifest {
+	m := schema1.Manifest{Versioned: schema1.SchemaVersion, Name: "repo", Tag: "old", Architecture: "amd64"}
+	for i := range history {
+		m.History = append(m.History, schema1.History{V1Compatibility: history[i]})
+		m.FSLayers = append(m.FSLayers, schema1.FSLayer{BlobSum: layers[i]})
+	}
+	return m
+}
+
+func TestManifestDigest(t *testing.T) {
+	key, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal("failed to generate key", err)
+	}
+	m := testSchema1Manifest([]string{`{"id":"a"}`}, digest.FromString("layer"))
+	signed, err := schema1.Sign(&m, key)
+	if err != nil {
+		t.Fatal("failed to sign manifest", err)
+	}
+	_, payload, _ := signed.Payload()
+
+	t.Run("signed", func(t *testing.T) {
+		d, err := manifestDigest(schema1.MediaTypeSignedManifest, payload)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if d != digest.FromBytes(signed.Canonical) || d == digest.FromBytes(payload) {
+			t.Errorf("expected digest of canonical bytes; got %s", d)
+		}
+	})
+
+	t.Run("get signed manifest", func(t *testing.T) {
+		response := manifestResponse("application/json", string(payload))
+		response.Header.Set("Docker-Content-Digest", digest.FromBytes(signed.Canonical).String())
+		client := Client{client: CreateMockHTTPClient(response)}
+		manifest, err := client.GetManifest("http://hello/v2/repo/manifests/old")
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if manifest.MediaType != schema1.MediaTypeSignedManifest || !manifest.IsSchema1() {
+			t.Errorf("expected signed schema1 manifest; got %s", manifest.MediaType)
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		_, err := manifestDigest(schema1.MediaTypeSignedManifest, []byte(`{"schemaVersion":1}`))
+		if err == nil {
+			t.Error("expected non nil error")
+		}
+	})
+}
+
+func TestConvertSchema1(t *testing.T) {
+	var layer bytes.Buffer
+	gz := gzip.NewWriter(&layer)
+	gz.Write([]byte("layer content"))
+	gz.Close()
+	layerDigest := digest.FromBytes(layer.Bytes())
+	m := testSchema1Manifest([]string{
+		`{"id":"b","parent":"a","created":"2020-01-02T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) CMD [\"run\"]"]},"throwaway":true,"config":{"Cmd":["run"]},"os":"linux","architecture":"amd64"}`,
+		`{"id":"a","created":"2020-01-01T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD file"]}}`,
+	}, digest.FromString("empty"), layerDigest)
+	payload, _ := json.Marshal(m)
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		client := Client{}
+		_, err := client.ConvertSchema1("http://hello/v2/repo/manifests/old", "text/plain")
+		if err == nil || !strings.Contains(err.Error(), "cannot convert") {
+			t.Errorf("expected cannot convert; got %s", err)
+		}
+	})
+
+	t.Run("schema2", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(
+			manifestResponse(schema1.MediaTypeManifest, string(payload)),
+			blobResponse(layer.String()),
+			http.Response{StatusCode: 404},
+			http.Response{StatusCode: 202, Header: map[string][]string{"Location": {"/upload"}}},
+			http.Response{StatusCode: 201},
+		)}
+		manifest, err := client.ConvertSchema1("http://hello/v2/repo/manifests/old", schema2.MediaTypeManifest)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		im, err := manifest.imageManifest()
+		if err != nil {
+			t.Fatalf("expected image manifest; got %s", err)
+		}
+		if len(im.Layers) != 1 || im.Layers[0].Digest != layerDigest || im.Layers[0].Size != int64(layer.Len()) {
+			t.Errorf("expected a single layer; got %+v", im.Layers)
+		}
+		if im.Layers[0].MediaType != schema2.MediaTypeLayer || im.Config.MediaType != schema2.MediaTypeImageConfig {
+			t.Errorf("unexpected media types; got %+v", im)
+		}
+	})
+}
+
+func TestSchema1Config(t *testing.T) {
+	config, err := schema1Config(`{"id":"b","parent":"a","os":"linux","config":{"Cmd":["run"]}}`, []digest.Digest{digest.FromString("diff")}, nil)
+	if err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(config, &decoded)
+	if _, exists := decoded["id"]; exists {
+		t.Errorf("expected id to be removed; got %s", config)
+	}
+	if decoded["os"] != "linux" || !strings.Contains(string(config), digest.FromString("diff").String()) {
+		t.Errorf("expected os and diff ids; got %s", config)
+	}
+}
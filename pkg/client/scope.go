@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// repositoryPath matches the API paths that act on a repository, capturing the repository name.
+var repositoryPath = regexp.MustCompile(`^/v2/(.+)/(manifests/[^/]+|blobs/uploads/[^/]*|blobs/[^/]+|tags/list|referrers/[^/]+)$`)
+
+// requiredScopes returns the token scopes the request needs, in the type:name:actions form of the distribution token
+// spec. Cross repository blob mounts also need pull access to the repository the blob is mounted from, so asking for
+// both up front saves a second challenge.
+func requiredScopes(request *http.Request) []string {
+	if request.URL.Path == "/v2/_catalog" {
+		return []string{"registry:catalog:*"}
+	}
+	repository := requestRepository(request)
+	if repository == "" {
+		return nil
+	}
+	actions := "pull,push"
+	switch request.Method {
+	case "GET", "HEAD":
+		actions = "pull"
+	case "DELETE":
+		actions = "delete"
+	}
+	scopes := []string{"repository:" + repository + ":" + actions}
+	if from := request.URL.Query().Get("from"); from != "" && request.URL.Query().Get("mount") != "" {
+		scopes = append(scopes, "repository:"+from+":pull")
+	}
+	return scopes
+}
+
+// requestRepository returns the name of the repository the request acts on, or an empty string if it doesn't act on
+// one.
+func requestRepository(request *http.Request) string {
+	if match := repositoryPath.FindStringSubmatch(request.URL.Path); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// splitScope splits a scope into its resource, type:name, and its actions.
+func splitScope(scope string) (string, []string) {
+	i := strings.LastIndex(scope, ":")
+	if i < 0 {
+		return scope, nil
+	}
+	return scope[:i], strings.Split(scope[i+1:], ",")
+}
+
+// mergeScopes combines scopes for the same resource into one with the union of their actions, keeping the order in
+// which resources and actions first appear.
+func mergeScopes(scopes []string) []string {
+	var resources []string
+	actions := make(map[string][]string)
+	for _, scope := range scopes {
+		if scope == "" {
+			continue
+		}
+		resource, scopeActions := splitScope(scope)
+		existing, exists := actions[resource]
+		if !exists {
+			resources = append(resources, resource)
+		}
+		for _, action := range scopeActions {
+			if action != "" && !contains(existing, action) {
+				existing = append(existing, action)
+			}
+		}
+		actions[resource] = existing
+	}
+	merged := make([]string, len(resources))
+	for i, resource := range resources {
+		merged[i] = resource
+		if len(actions[resource]) > 0 {
+			merged[i] += ":" + strings.Join(actions[resource], ",")
+		}
+	}
+	return merged
+}
+
+// coversScopes reports whether the granted scopes include every action of the required ones.
+func coversScopes(granted []string, required []string) bool {
+	actions := make(map[string][]string)
+	for _, scope := range granted {
+		resource, scopeActions := splitScope(scope)
+		actions[resource] = append(actions[resource], scopeActions...)
+	}
+	for _, scope := range required {
+		resource, scopeActions := splitScope(scope)
+		for _, action := range scopeActions {
+			if !contains(actions[resource], action) && !contains(actions[resource], "*") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// accessClaimScopes returns the scopes in the access claim of a JWT token, as issued by the distribution token server.
+// It returns false if the token isn't a JWT or has no access claim, in which case the scopes granted aren't known. An
+// access claim that is null or empty grants nothing, and gives an empty rather than nil slice.
+func accessClaimScopes(token string) ([]string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, false
+	}
+	var claims map[string]json.RawMessage
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	claim, exists := claims["access"]
+	if !exists {
+		return nil, false
+	}
+	var access []struct {
+		Type    string   `json:"type"`
+		Name    string   `json:"name"`
+		Actions []string `json:"actions"`
+	}
+	if err = json.Unmarshal(claim, &access); err != nil {
+		return nil, false
+	}
+	var scopes []string
+	for _, resource := range access {
+		if len(resource.Actions) > 0 {
+			scopes = append(scopes, resource.Type+":"+resource.Name+":"+strings.Join(resource.Actions, ","))
+		}
+	}
+	return mergeScopes(scopes), true
+}
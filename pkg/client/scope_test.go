@@ -0,0 +1,92 @@
+package client
+
+import (
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequiredScopes(t *testing.T) {
+	for _, test := range []struct {
+		method   string
+		url      string
+		expected []string
+	}{
+		{"GET", "http://my.host/v2/", nil},
+		{"GET", "http://my.host/v2/_catalog?n=10", []string{"registry:catalog:*"}},
+		{"GET", "http://my.host/v2/team/app/manifests/latest", []string{"repository:team/app:pull"}},
+		{"HEAD", "http://my.host/v2/app/blobs/sha256:abc", []string{"repository:app:pull"}},
+		{"GET", "http://my.host/v2/app/tags/list", []string{"repository:app:pull"}},
+		{"GET", "http://my.host/v2/app/referrers/sha256:abc", []string{"repository:app:pull"}},
+		{"PUT", "http://my.host/v2/app/manifests/v1", []string{"repository:app:pull,push"}},
+		{"PATCH", "http://my.host/v2/app/blobs/uploads/123", []string{"repository:app:pull,push"}},
+		{"DELETE", "http://my.host/v2/app/manifests/sha256:abc", []string{"repository:app:delete"}},
+		{"POST", "http://my.host/v2/app/blobs/uploads/?mount=sha256:abc&from=base/os", []string{"repository:app:pull,push", "repository:base/os:pull"}},
+		{"POST", "http://my.host/v2/app/blobs/uploads/", []string{"repository:app:pull,push"}},
+		{"GET", "http://my.host/v2/a/manifests/b/blobs/sha256:abc", []string{"repository:a/manifests/b:pull"}},
+	} {
+		request, _ := http.NewRequest(test.method, test.url, nil)
+		if scopes := requiredScopes(request); !reflect.DeepEqual(scopes, test.expected) {
+			t.Errorf("%s %s: expected %s; got %s", test.method, test.url, test.expected, scopes)
+		}
+	}
+}
+
+func TestMergeScopes(t *testing.T) {
+	scopes := mergeScopes([]string{"repository:a:pull", "", "registry:catalog:*", "repository:a:push,pull", "repository:b:pull", "odd"})
+	expected := []string{"repository:a:pull,push", "registry:catalog:*", "repository:b:pull", "odd"}
+	if !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("expected %s; got %s", expected, scopes)
+	}
+}
+
+func TestCoversScopes(t *testing.T) {
+	granted := []string{"repository:a:pull,push", "repository:b:pull", "registry:catalog:*"}
+	for _, test := range []struct {
+		required []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"repository:a:pull"}, true},
+		{[]string{"repository:a:push", "repository:b:pull"}, true},
+		{[]string{"registry:catalog:*"}, true},
+		{[]string{"repository:b:push"}, false},
+		{[]string{"repository:c:pull"}, false},
+		{[]string{"repository:a:delete"}, false},
+	} {
+		if covered := coversScopes(granted, test.required); covered != test.expected {
+			t.Errorf("%s: expected %t; got %t", test.required, test.expected, covered)
+		}
+	}
+}
+
+func TestAccessClaimScopes(t *testing.T) {
+	jwt := func(claims string) string {
+		return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+	}
+	t.Run("access claim", func(t *testing.T) {
+		scopes, ok := accessClaimScopes(jwt(`{"access":[{"type":"repository","name":"a","actions":["pull"]},` +
+			`{"type":"repository","name":"a","actions":["push"]},{"type":"repository","name":"b","actions":[]}]}`))
+		if !ok || !reflect.DeepEqual(scopes, []string{"repository:a:pull,push"}) {
+			t.Errorf("expected repository:a:pull,push; got %s and %t", scopes, ok)
+		}
+	})
+	t.Run("empty access claim", func(t *testing.T) {
+		for _, claims := range []string{`{"access":null}`, `{"access":[]}`} {
+			if scopes, ok := accessClaimScopes(jwt(claims)); !ok || scopes == nil || len(scopes) != 0 {
+				t.Errorf("%s: expected no scopes granted; got %s and %t", claims, scopes, ok)
+			}
+		}
+	})
+	t.Run("no access claim", func(t *testing.T) {
+		if scopes, ok := accessClaimScopes(jwt(`{"sub":"me"}`)); ok {
+			t.Errorf("expected no scopes; got %s", scopes)
+		}
+	})
+	t.Run("opaque token", func(t *testing.T) {
+		if scopes, ok := accessClaimScopes("token-1"); ok {
+			t.Errorf("expected no scopes; got %s", scopes)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// TestingT is the part of testing.TB that a ScriptedHTTPClient uses, so that pkg/client doesn't link the testing
+// package into every binary that uses it.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Expectation is a request that a ScriptedHTTPClient expects, along with the response or error to give it. Empty
+// request fields match anything; Query and Header only need to contain the listed values.
+type Expectation struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+
+	// StatusCode defaults to 200.
+	StatusCode     int
+	ResponseHeader http.Header
+	Body           string
+	Err            error
+	// Times is the number of requests the expectation is for, which defaults to one.
+	Times int
+}
+
+// RecordedRequest is a request received by a ScriptedHTTPClient.
+type RecordedRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// ScriptedHTTPClient is an HTTPClient that answers requests according to a list of expectations, failing the test on
+// requests that don't match any remaining expectation and, at the end of the test, on expectations that weren't met.
+// Expectations are matched in the order given, so the first matching one with requests left is used.
+type ScriptedHTTPClient struct {
+	t            TestingT
+	mutex        sync.Mutex
+	expectations []*Expectation
+	requests     []RecordedRequest
+}
+
+// CreateScriptedHTTPClient creates a ScriptedHTTPClient with the expectations.
+func CreateScriptedHTTPClient(t TestingT, expectations ...Expectation) *ScriptedHTTPClient {
+	m := &ScriptedHTTPClient{t: t}
+	for _, expectation := range expectations {
+		m.Expect(expectation)
+	}
+	t.Cleanup(m.AssertConsumed)
+	return m
+}
+
+// Expect adds an expectation.
+func (m *ScriptedHTTPClient) Expect(expectation Expectation) {
+	if expectation.Times <= 0 {
+		expectation.Times = 1
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.expectations = append(m.expectations, &expectation)
+}
+
+// Do records the request and returns the response of the first matching expectation.
+func (m *ScriptedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	recorded := RecordedRequest{Method: req.Method, URL: req.URL, Header: req.Header.Clone()}
+	if req.Body != nil {
+		recorded.Body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, recorded)
+	for _, expectation := range m.expectations {
+		if expectation.Times == 0 || !expectation.matches(req) {
+			continue
+		}
+		expectation.Times--
+		if expectation.Err != nil {
+			return nil, expectation.Err
+		}
+		header := expectation.ResponseHeader.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		statusCode := expectation.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		return &http.Response{
+			StatusCode:    statusCode,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(expectation.Body)),
+			ContentLength: int64(len(expectation.Body)),
+			Request:       req,
+		}, nil
+	}
+	m.t.Errorf("unexpected request %s %s", req.Method, req.URL)
+	return nil, errors.New("unexpected request " + req.Method + " " + req.URL.String())
+}
+
+func (e *Expectation) matches(req *http.Request) bool {
+	if (e.Method != "" && e.Method != req.Method) || (e.Path != "" && e.Path != req.URL.Path) {
+		return false
+	}
+	query := req.URL.Query()
+	for key, values := range e.Query {
+		if strings.Join(query[key], ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	for key, values := range e.Header {
+		if strings.Join(req.Header.Values(key), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// Requests returns the requests received so far.
+func (m *ScriptedHTTPClient) Requests() []RecordedRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]RecordedRequest(nil), m.requests...)
+}
+
+// AssertConsumed fails the test if any expectation has requests left. It is called automatically when the test ends.
+func (m *ScriptedHTTPClient) AssertConsumed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, expectation := range m.expectations {
+		if expectation.Times > 0 {
+			m.t.Errorf("expected %d more %s %s request(s)", expectation.Times, expectation.Method, expectation.Path)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// recordingT is a testing.TB that records failures instead of failing the test, and runs cleanups on demand.
+type recordingT struct {
+	testing.TB
+	failures []string
+	cleanups []func()
+}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordingT) finish() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+
+func TestScriptedHTTPClient(t *testing.T) {
+	t.Run("matches requests", func(t *testing.T) {
+		mock := CreateScriptedHTTPClient(t,
+			Expectation{Method: "GET", Path: "/v2/repo/blobs/sha256:abc", Body: "blob"},
+			Expectation{Method: "GET", Path: "/v2/repo/tags/list", Query: url.Values{"n": {"2"}}, Body: "page", Times: 2},
+			Expectation{Method: "GET", Header: http.Header{"Authorization": {"Basic abc"}}, StatusCode: 401},
+		)
+		for _, test := range []struct {
+			url    string
+			auth   string
+			status int
+			body   string
+		}{
+			{"http://hello/v2/repo/tags/list?n=2", "", 200, "page"},
+			{"http://hello/v2/repo/blobs/sha256:abc", "", 200, "blob"},
+			{"http://hello/v2/repo/tags/list?n=2&last=b", "", 200, "page"},
+			{"http://hello/v2/other", "Basic abc", 401, ""},
+		} {
+			request, _ := http.NewRequest("GET", test.url, nil)
+			if test.auth != "" {
+				request.Header.Set("Authorization", test.auth)
+			}
+			response, err := mock.Do(request)
+			if err != nil || response.StatusCode != test.status {
+				t.Fatalf("%s: expected %d; got %v and %v", test.url, test.status, response, err)
+			}
+			if body, _ := ioutil.ReadAll(response.Body); string(body) != test.body {
+				t.Errorf("%s: expected %s; got %s", test.url, test.body, body)
+			}
+		}
+	})
+
+	t.Run("records requests", func(t *testing.T) {
+		d := digest.FromString("hello")
+		mock := CreateScriptedHTTPClient(t,
+			Expectation{Method: "HEAD", StatusCode: 404},
+			Expectation{Method: "POST", StatusCode: 202, ResponseHeader: http.Header{"Location": {"/upload/1"}}},
+			Expectation{Method: "PUT", Path: "/upload/1", Query: url.Values{"digest": {d.String()}}, StatusCode: 201},
+		)
+		client := Client{client: mock}
+		ref, _ := ParseReference("http://hello/v2/repo/manifests/latest")
+		if _, err := client.PutBlob(ref, "application/octet-stream", []byte("hello")); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		requests := mock.Requests()
+		if len(requests) != 3 || string(requests[2].Body) != "hello" || requests[2].Header.Get("Content-Type") != "application/octet-stream" {
+			t.Errorf("expected the blob to be PUT; got %+v", requests)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mock := CreateScriptedHTTPClient(t, Expectation{Method: "GET", Err: errors.New("connection refused")})
+		request, _ := http.NewRequest("GET", "http://hello/v2/", nil)
+		if _, err := mock.Do(request); err == nil || err.Error() != "connection refused" {
+			t.Errorf("expected connection refused; got %v", err)
+		}
+	})
+
+	t.Run("unexpected request", func(t *testing.T) {
+		recorder := &recordingT{TB: t}
+		mock := CreateScriptedHTTPClient(recorder)
+		request, _ := http.NewRequest("DELETE", "http://hello/v2/repo/manifests/latest", nil)
+		if _, err := mock.Do(request); err == nil {
+			t.Error("expected an error")
+		}
+		if len(recorder.failures) != 1 || !strings.Contains(recorder.failures[0], "unexpected request DELETE") {
+			t.Errorf("expected the test to fail; got %s", recorder.failures)
+		}
+	})
+
+	t.Run("unconsumed expectation", func(t *testing.T) {
+		recorder := &recordingT{TB: t}
+		CreateScriptedHTTPClient(recorder, Expectation{Method: "GET", Path: "/v2/"})
+		recorder.finish()
+		if len(recorder.failures) != 1 || !strings.Contains(recorder.failures[0], "expected 1 more GET /v2/") {
+			t.Errorf("expected the test to fail; got %s", recorder.failures)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ListTags returns all the tags in the repository of repo, following the registry's pagination links.
+func (c *Client) ListTags(repo Reference) ([]string, error) {
+	tags, err := c.listTags(repo)
+	if err != nil {
+		log.Println("failed to list tags", repo.Host+"/"+repo.Repository, err)
+	}
+	return tags, err
+}
+
+func (c *Client) listTags(repo Reference) ([]string, error) {
+	var tags []string
+	queryURL := repo.repositoryURL() + "/tags/list"
+	for queryURL != "" {
+		request, err := http.NewRequest("GET", queryURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := c.do(request, "")
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		if queryURL, err = nextLink(request.URL, response.Header); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestListTags(t *testing.T) {
+	repo, _ := ParseReference("http://hello/v2/repo/manifests/latest")
+
+	t.Run("pages", func(t *testing.T) {
+		first := blobResponse(`{"name":"repo","tags":["a","b"]}`)
+		first.Header = http.Header{"Link": {`</v2/repo/tags/list?last=b&n=2>; rel="next"`}}
+		client := Client{client: CreateMockHTTPClient(first, blobResponse(`{"name":"repo","tags":["c"]}`))}
+		tags, err := client.ListTags(repo)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if strings.Join(tags, ",") != "a,b,c" {
+			t.Errorf("expected a,b,c; got %s", tags)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		client := Client{client: CreateMockHTTPClient(http.Response{StatusCode: 404})}
+		_, err := client.ListTags(repo)
+		if !IsNotFound(err) {
+			t.Errorf("expected not found; got %s", err)
+		}
+	})
+}
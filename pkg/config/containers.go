@@ -0,0 +1,323 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+)
+
+// DefaultAuthFiles returns the credential files podman and docker use, in the order podman looks at them:
+// ${XDG_RUNTIME_DIR}/containers/auth.json, ${XDG_CONFIG_HOME}/containers/auth.json, docker's config.json and the
+// legacy ~/.dockercfg. As with podman, the file named by REGISTRY_AUTH_FILE is the only one used when it is set. Files
+// that don't exist are included.
+func DefaultAuthFiles() []string {
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		return []string{path}
+	}
+	var paths []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "containers", "auth.json"))
+	}
+	home, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "containers", "auth.json"))
+	}
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "config.json"))
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".docker", "config.json"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".dockercfg"))
+	}
+	return paths
+}
+
+// LoadAuthFiles loads the auths of containers-auth.json files, docker config.json files and legacy .dockercfg files,
+// skipping any that don't exist, and merges them into a single Docker config file object that the client can use.
+// Keys may name a namespace of a registry, such as quay.io/org/repo.
+//
+// As with podman, an image's credentials come from the first file with a key that matches it, using that file's most
+// specific key. The client looks for the most specific key of the merged config, so a key is left out when an earlier
+// file has one for a registry or namespace containing it; quay.io/org in docker's config.json must not beat quay.io
+// in podman's auth.json. Empty auths, which docker writes when a credential store is used, are skipped. Only the auths
+// are read, so a docker config.json without any, such as one that only names a credential store, adds nothing, and
+// credential helpers aren't run. Files named .dockercfg are read as the legacy flat map of auths.
+func LoadAuthFiles(paths ...string) (*configfile.ConfigFile, error) {
+	merged := &configfile.ConfigFile{AuthConfigs: make(map[string]types.AuthConfig)}
+	var keys []string
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		auths, err := parseAuthFile(path, content)
+		if err != nil {
+			return nil, errors.New("failed to load auth file " + path + " - " + err.Error())
+		}
+		var added []string
+		for key, auth := range auths {
+			if _, exists := merged.AuthConfigs[key]; exists || isEmptyAuth(auth) || containedBy(keys, key) {
+				continue
+			}
+			merged.AuthConfigs[key] = auth
+			added = append(added, key)
+		}
+		keys = append(keys, added...)
+	}
+	return merged, nil
+}
+
+// parseAuthFile returns the auths of an auth file, which are under the auths key of everything but a legacy
+// .dockercfg file. Other keys, such as those of docker's config.json, are ignored.
+func parseAuthFile(path string, content []byte) (map[string]types.AuthConfig, error) {
+	if filepath.Base(path) == DockerCfgKey {
+		return parsePullSecret(content)
+	}
+	var file struct {
+		Auths map[string]types.AuthConfig `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	return normalizeAuths(file.Auths), nil
+}
+
+// containedBy reports whether any of the keys names a registry or namespace containing key, as quay.io does
+// quay.io/org.
+func containedBy(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.HasPrefix(key, k+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// RegistriesConf holds the registry settings of a containers registries.conf file.
+type RegistriesConf struct {
+	UnqualifiedSearchRegistries []string   `toml:"unqualified-search-registries"`
+	Registries                  []Registry `toml:"registry"`
+}
+
+// Registry holds the settings for the images whose names start with Prefix, as given by a [[registry]] table. Prefix
+// may also be a wildcard such as *.example.com, matching any subdomain.
+type Registry struct {
+	Prefix             string   `toml:"prefix"`
+	Location           string   `toml:"location"`
+	Insecure           bool     `toml:"insecure"`
+	Blocked            bool     `toml:"blocked"`
+	MirrorByDigestOnly bool     `toml:"mirror-by-digest-only"`
+	Mirrors            []Mirror `toml:"mirror"`
+}
+
+// Mirror is a location to try pulling a registry's images from before the registry itself.
+type Mirror struct {
+	Location string `toml:"location"`
+	Insecure bool   `toml:"insecure"`
+	// PullFromMirror is all, digest-only or tag-only, restricting which references the mirror is used for.
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+// PullSource is a place to pull an image from.
+type PullSource struct {
+	Reference string
+	Insecure  bool
+}
+
+// FindRegistriesConf returns the registries.conf file podman would use: the file named by CONTAINERS_REGISTRIES_CONF,
+// ${XDG_CONFIG_HOME}/containers/registries.conf or /etc/containers/registries.conf, whichever exists first. It returns
+// an empty string if there is none.
+func FindRegistriesConf() string {
+	var paths []string
+	if path := os.Getenv("CONTAINERS_REGISTRIES_CONF"); path != "" {
+		paths = append(paths, path)
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if home, err := os.UserHomeDir(); configHome == "" && err == nil {
+		configHome = filepath.Join(home, ".config")
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "containers", "registries.conf"))
+	}
+	paths = append(paths, "/etc/containers/registries.conf")
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadRegistriesConf loads a registries.conf file, along with the *.conf drop-in files of the registries.conf.d
+// directory beside it, if there is one, in name order. Settings in a drop-in replace those before it: a registry
+// replaces any with the same prefix, and unqualified-search-registries replaces the whole list. Both the current
+// format, with [[registry]] tables, and the older format, with [registries.search], [registries.insecure] and
+// [registries.block] lists, are understood.
+func LoadRegistriesConf(path string) (*RegistriesConf, error) {
+	conf, err := loadRegistriesConfFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dropIns, err := filepath.Glob(filepath.Join(path+".d", "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dropIns)
+	for _, dropIn := range dropIns {
+		next, err := loadRegistriesConfFile(dropIn)
+		if err != nil {
+			return nil, err
+		}
+		conf.merge(next)
+	}
+	return conf, nil
+}
+
+// registriesConfFile is the layout of a registries.conf file, which may also hold the older format's tables.
+type registriesConfFile struct {
+	RegistriesConf
+	V1 struct {
+		Search   v1Registries `toml:"search"`
+		Insecure v1Registries `toml:"insecure"`
+		Block    v1Registries `toml:"block"`
+	} `toml:"registries"`
+}
+
+type v1Registries struct {
+	Registries []string `toml:"registries"`
+}
+
+func loadRegistriesConfFile(path string) (*RegistriesConf, error) {
+	var file registriesConfFile
+	metadata, err := toml.DecodeFile(path, &file)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("failed to parse " + path + " - " + err.Error())
+	}
+	conf := &file.RegistriesConf
+	// a drop-in's empty list still replaces the list before it, so must not be left nil
+	if metadata.IsDefined("unqualified-search-registries") && conf.UnqualifiedSearchRegistries == nil {
+		conf.UnqualifiedSearchRegistries = []string{}
+	}
+	for i := range conf.Registries {
+		if conf.Registries[i].Prefix == "" {
+			conf.Registries[i].Prefix = conf.Registries[i].Location
+		}
+	}
+	conf.UnqualifiedSearchRegistries = append(conf.UnqualifiedSearchRegistries, file.V1.Search.Registries...)
+	for _, location := range file.V1.Insecure.Registries {
+		conf.findOrAdd(location).Insecure = true
+	}
+	for _, location := range file.V1.Block.Registries {
+		conf.findOrAdd(location).Blocked = true
+	}
+	return conf, nil
+}
+
+// merge applies the settings of a drop-in file on top of the conf.
+func (c *RegistriesConf) merge(dropIn *RegistriesConf) {
+	if dropIn.UnqualifiedSearchRegistries != nil {
+		c.UnqualifiedSearchRegistries = dropIn.UnqualifiedSearchRegistries
+	}
+	for _, registry := range dropIn.Registries {
+		replaced := false
+		for i := range c.Registries {
+			if c.Registries[i].Prefix == registry.Prefix {
+				c.Registries[i], replaced = registry, true
+			}
+		}
+		if !replaced {
+			c.Registries = append(c.Registries, registry)
+		}
+	}
+}
+
+// findOrAdd returns the registry with the location as its prefix, adding one if there is none, for the older
+// format's lists of locations.
+func (c *RegistriesConf) findOrAdd(location string) *Registry {
+	for i := range c.Registries {
+		if c.Registries[i].Prefix == location {
+			return &c.Registries[i]
+		}
+	}
+	c.Registries = append(c.Registries, Registry{Prefix: location, Location: location})
+	return &c.Registries[len(c.Registries)-1]
+}
+
+// FindRegistry returns the settings for the image, which is a fully qualified name such as quay.io/org/app:v1. When
+// several prefixes match, the longest wins.
+func (c *RegistriesConf) FindRegistry(image string) (Registry, bool) {
+	var found Registry
+	exists := false
+	for _, registry := range c.Registries {
+		if registry.matches(image) && (!exists || len(registry.Prefix) > len(found.Prefix)) {
+			found, exists = registry, true
+		}
+	}
+	return found, exists
+}
+
+func (r Registry) matches(image string) bool {
+	if strings.HasPrefix(r.Prefix, "*.") {
+		host := image
+		if i := strings.Index(host, "/"); i >= 0 {
+			host = host[:i]
+		}
+		return strings.HasSuffix(host, r.Prefix[1:])
+	}
+	if !strings.HasPrefix(image, r.Prefix) {
+		return false
+	}
+	rest := image[len(r.Prefix):]
+	return rest == "" || strings.IndexByte("/:@", rest[0]) >= 0
+}
+
+// PullSources returns the places to pull the image from, in the order to try them: the registry's mirrors that apply
+// to the reference, then the registry's own location. An image without settings is pulled from where it is, and an
+// error is returned for an image from a blocked registry.
+func (c *RegistriesConf) PullSources(image string) ([]PullSource, error) {
+	registry, exists := c.FindRegistry(image)
+	if !exists {
+		return []PullSource{{Reference: image}}, nil
+	}
+	if registry.Blocked {
+		return nil, errors.New("registry " + registry.Prefix + " is blocked - cannot pull " + image)
+	}
+	byDigest := strings.Contains(image, "@")
+	var sources []PullSource
+	rewrite := func(location string) string {
+		if strings.HasPrefix(registry.Prefix, "*.") || location == "" {
+			return image
+		}
+		return location + image[len(registry.Prefix):]
+	}
+	for _, mirror := range registry.Mirrors {
+		pullFrom := mirror.PullFromMirror
+		if registry.MirrorByDigestOnly {
+			pullFrom = "digest-only"
+		}
+		if pullFrom == "digest-only" && !byDigest || pullFrom == "tag-only" && byDigest {
+			continue
+		}
+		sources = append(sources, PullSource{Reference: rewrite(mirror.Location), Insecure: mirror.Insecure})
+	}
+	return append(sources, PullSource{Reference: rewrite(registry.Location), Insecure: registry.Insecure}), nil
+}
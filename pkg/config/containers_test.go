@@ -0,0 +1,216 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultAuthFiles(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("REGISTRY_AUTH_FILE", "/etc/auth.json")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("DOCKER_CONFIG", "")
+	if paths := DefaultAuthFiles(); !reflect.DeepEqual(paths, []string{"/etc/auth.json"}) {
+		t.Errorf("expected only REGISTRY_AUTH_FILE; got %s", paths)
+	}
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	expected := []string{
+		"/run/user/1000/containers/auth.json",
+		"/home/me/.config/containers/auth.json",
+		"/home/me/.docker/config.json",
+		"/home/me/.dockercfg",
+	}
+	if paths := DefaultAuthFiles(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %s; got %s", expected, paths)
+	}
+}
+
+func TestLoadAuthFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth-files")
+	if err != nil {
+		t.Fatal("failed to create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	podman := writeSecret(t, dir, "auth.json", `{"auths":{"quay.io/org/repo":{"auth":"cmVwbw=="},"quay.io":{"auth":"cXVheQ=="}}}`)
+	docker := writeSecret(t, dir, "config.json", `{"auths":{"https://index.docker.io/v1/":{"auth":"aHVi"},"quay.io":{"auth":"ZG9ja2Vy"}},"credsStore":"desktop"}`)
+
+	cfg, err := LoadAuthFiles(filepath.Join(dir, "missing.json"), podman, docker)
+	if err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	for key, expected := range map[string]string{
+		"quay.io/org/repo":     "cmVwbw==",
+		"quay.io":              "cXVheQ==",
+		"registry-1.docker.io": "aHVi",
+	} {
+		if cfg.AuthConfigs[key].Auth != expected {
+			t.Errorf("%s: expected %s; got %+v", key, expected, cfg.AuthConfigs[key])
+		}
+	}
+
+	t.Run("first file with a match", func(t *testing.T) {
+		runtime := writeSecret(t, dir, "runtime.json", `{"auths":{"my.host":{"auth":"aG9zdA=="},"other.host":{}}}`)
+		config := writeSecret(t, dir, "namespaced.json", `{"auths":{"my.host/org":{"auth":"b3Jn"},"my.hostname/org":{"auth":"bmFtZQ=="},`+
+			`"other.host":{"auth":"b3RoZXI="}}}`)
+		cfg, err := LoadAuthFiles(runtime, config)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if _, exists := cfg.AuthConfigs["my.host/org"]; exists {
+			t.Errorf("expected my.host to hide my.host/org; got %+v", cfg.AuthConfigs)
+		}
+		if cfg.AuthConfigs["my.hostname/org"].Auth != "bmFtZQ==" || cfg.AuthConfigs["other.host"].Auth != "b3RoZXI=" {
+			t.Errorf("expected my.hostname/org and the other.host credentials; got %+v", cfg.AuthConfigs)
+		}
+	})
+
+	t.Run("config without auths", func(t *testing.T) {
+		config := writeSecret(t, dir, "docker.json", `{"currentContext":"colima","credsStore":"desktop"}`)
+		cfg, err := LoadAuthFiles(podman, config)
+		if err != nil || cfg.AuthConfigs["quay.io"].Auth != "cXVheQ==" {
+			t.Errorf("expected the podman credentials and nil error; got %+v and %v", cfg, err)
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		legacy := writeSecret(t, dir, DockerCfgKey, `{"https://old.host/v1/":{"auth":"b2xk"}}`)
+		cfg, err := LoadAuthFiles(legacy)
+		if err != nil || cfg.AuthConfigs["old.host"].Auth != "b2xk" {
+			t.Errorf("expected the old.host credentials; got %+v and %v", cfg, err)
+		}
+	})
+
+	bad := writeSecret(t, dir, "bad.json", "rubbish")
+	if _, err = LoadAuthFiles(podman, bad); err == nil || !strings.Contains(err.Error(), "bad.json") {
+		t.Errorf("expected an error for bad.json; got %v", err)
+	}
+}
+
+func TestFindRegistriesConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registries-conf")
+	if err != nil {
+		t.Fatal("failed to create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "containers"), 0700)
+	user := writeSecret(t, filepath.Join(dir, "containers"), "registries.conf", "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("CONTAINERS_REGISTRIES_CONF", filepath.Join(dir, "missing.conf"))
+	if path := FindRegistriesConf(); path != user {
+		t.Errorf("expected %s; got %s", user, path)
+	}
+	t.Setenv("CONTAINERS_REGISTRIES_CONF", user+".d")
+	writeSecret(t, dir, "containers/registries.conf.d", "")
+	if path := FindRegistriesConf(); path != user+".d" {
+		t.Errorf("expected %s.d; got %s", user, path)
+	}
+}
+
+func TestRegistriesConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registries-conf")
+	if err != nil {
+		t.Fatal("failed to create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeSecret(t, dir, "registries.conf", `
+unqualified-search-registries = ["docker.io"]
+
+[[registry]]
+location = "docker.io"
+[[registry.mirror]]
+location = "mirror.local:5000"
+insecure = true
+[[registry.mirror]]
+location = "digests.local"
+pull-from-mirror = "digest-only"
+
+[[registry]]
+prefix = "docker.io/library/busybox"
+location = "internal.io/busybox"
+mirror-by-digest-only = true
+[[registry.mirror]]
+location = "mirror.local:5000/busybox"
+
+[[registry]]
+prefix = "*.blocked.io"
+blocked = true
+
+[registries.insecure]
+registries = ["dev.local"]
+"not=a.setting" = 'C:\ignored'
+
+[registries.block]
+registries = ["docker.io/evil"]
+`)
+	conf, err := LoadRegistriesConf(path)
+	if err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	if !reflect.DeepEqual(conf.UnqualifiedSearchRegistries, []string{"docker.io"}) || len(conf.Registries) != 5 {
+		t.Fatalf("unexpected conf; got %+v", conf)
+	}
+
+	for image, expected := range map[string][]PullSource{
+		"docker.io/library/alpine:3": {{"mirror.local:5000/library/alpine:3", true}, {"docker.io/library/alpine:3", false}},
+		"docker.io/library/alpine@sha256:abc": {
+			{"mirror.local:5000/library/alpine@sha256:abc", true},
+			{"digests.local/library/alpine@sha256:abc", false},
+			{"docker.io/library/alpine@sha256:abc", false},
+		},
+		"docker.io/library/busybox:1":          {{"internal.io/busybox:1", false}},
+		"docker.io/library/busybox@sha256:abc": {{"mirror.local:5000/busybox@sha256:abc", false}, {"internal.io/busybox@sha256:abc", false}},
+		"docker.io/library/busyboxes:1":        {{"mirror.local:5000/library/busyboxes:1", true}, {"docker.io/library/busyboxes:1", false}},
+		"dev.local/app:1":                      {{"dev.local/app:1", true}},
+		"quay.io/org/app:1":                    {{"quay.io/org/app:1", false}},
+	} {
+		sources, err := conf.PullSources(image)
+		if err != nil || !reflect.DeepEqual(sources, expected) {
+			t.Errorf("%s: expected %+v; got %+v and %v", image, expected, sources, err)
+		}
+	}
+
+	for _, image := range []string{"docker.io/evil/app:1", "registry.blocked.io/app:1"} {
+		if _, err := conf.PullSources(image); err == nil || !strings.Contains(err.Error(), "is blocked") {
+			t.Errorf("%s: expected is blocked; got %v", image, err)
+		}
+	}
+
+	t.Run("drop-ins", func(t *testing.T) {
+		os.Mkdir(path+".d", 0700)
+		writeSecret(t, path+".d", "20-mirror.conf", `
+[[registry]]
+location = "docker.io"
+mirror = [{ location = "other.local", pull-from-mirror = "tag-only" }]
+`)
+		writeSecret(t, path+".d", "10-search.conf", `unqualified-search-registries = ["quay.io"]`)
+		writeSecret(t, path+".d", "ignored.txt", "rubbish")
+		conf, err := LoadRegistriesConf(path)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if !reflect.DeepEqual(conf.UnqualifiedSearchRegistries, []string{"quay.io"}) || len(conf.Registries) != 5 {
+			t.Fatalf("unexpected conf; got %+v", conf)
+		}
+		sources, err := conf.PullSources("docker.io/library/alpine:3")
+		expected := []PullSource{{"other.local/library/alpine:3", false}, {"docker.io/library/alpine:3", false}}
+		if err != nil || !reflect.DeepEqual(sources, expected) {
+			t.Errorf("expected %+v; got %+v and %v", expected, sources, err)
+		}
+		os.RemoveAll(path + ".d")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := LoadRegistriesConf(filepath.Join(dir, "missing.conf")); err == nil {
+			t.Error("expected an error for a missing file")
+		}
+		bad := writeSecret(t, dir, "bad.conf", "[[registry]\n")
+		if _, err := LoadRegistriesConf(bad); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+			t.Errorf("expected failed to parse; got %v", err)
+		}
+	})
+}
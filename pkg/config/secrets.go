@@ -0,0 +1,151 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+)
+
+// The keys of the two kinds of Kubernetes image pull secret, which are the file names when a secret is mounted.
+const (
+	DockerConfigJSONKey = ".dockerconfigjson"
+	DockerCfgKey        = ".dockercfg"
+)
+
+// LoadPullSecrets loads Kubernetes image pull secrets and merges them into a single Docker config file object that
+// the client can use. Each path is either a secret mounted as a directory, holding a .dockerconfigjson or .dockercfg
+// file, or one of those files itself. Both the kubernetes.io/dockerconfigjson format, with its auths wrapper, and the
+// flat map of the legacy kubernetes.io/dockercfg format are understood.
+//
+// When several secrets have credentials for the same registry the first one wins, so paths should be given in order
+// of precedence. Registry URL keys such as https://my.host/v1/ are reduced to the host, which is how the client looks
+// them up, and Docker Hub keys such as https://index.docker.io/v1/ become the registry-1.docker.io host it uses.
+func LoadPullSecrets(paths ...string) (*configfile.ConfigFile, error) {
+	var configs []*configfile.ConfigFile
+	for _, path := range paths {
+		auths, err := loadPullSecret(path)
+		if err != nil {
+			return nil, errors.New("failed to load pull secret " + path + " - " + err.Error())
+		}
+		configs = append(configs, &configfile.ConfigFile{AuthConfigs: auths})
+	}
+	return MergeConfigs(configs...), nil
+}
+
+// MergeConfigs merges the auths of the Docker config file objects, any of which may be nil, into a new one. The first
+// config with credentials for a registry wins. Empty auths, which docker writes for registries whose credentials are
+// kept in a credential store, are skipped so they don't hide the credentials of later configs.
+func MergeConfigs(configs ...*configfile.ConfigFile) *configfile.ConfigFile {
+	merged := &configfile.ConfigFile{AuthConfigs: make(map[string]types.AuthConfig)}
+	for _, config := range configs {
+		if config == nil {
+			continue
+		}
+		for registry, auth := range config.AuthConfigs {
+			if _, exists := merged.AuthConfigs[registry]; !exists && !isEmptyAuth(auth) {
+				merged.AuthConfigs[registry] = auth
+			}
+		}
+	}
+	return merged
+}
+
+func isEmptyAuth(auth types.AuthConfig) bool {
+	return auth.Auth == "" && auth.Username == "" && auth.Password == "" && auth.IdentityToken == "" &&
+		auth.RegistryToken == ""
+}
+
+func loadPullSecret(path string) (map[string]types.AuthConfig, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		path, err = findPullSecret(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePullSecret(content)
+}
+
+func findPullSecret(dir string) (string, error) {
+	for _, key := range []string{DockerConfigJSONKey, DockerCfgKey} {
+		path := filepath.Join(dir, key)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no " + DockerConfigJSONKey + " or " + DockerCfgKey + " in directory")
+}
+
+// parsePullSecret parses either secret format, telling them apart by the auths key that only dockerconfigjson has.
+func parsePullSecret(content []byte) (map[string]types.AuthConfig, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	if auths, exists := fields["auths"]; exists {
+		content = auths
+	}
+	var auths map[string]types.AuthConfig
+	if err := json.Unmarshal(content, &auths); err != nil {
+		return nil, err
+	}
+	return normalizeAuths(auths), nil
+}
+
+// normalizeAuths reduces the keys of the auths to the hosts the client looks credentials up under. Of the keys that
+// reduce to the same host, an exact host key wins, and otherwise the first in sorted order.
+func normalizeAuths(auths map[string]types.AuthConfig) map[string]types.AuthConfig {
+	// the keys are sorted so that when several reduce to the same host, such as https://index.docker.io/v1/ and
+	// docker.io, the same one wins every time
+	registries := make([]string, 0, len(auths))
+	for registry := range auths {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+	normalized := make(map[string]types.AuthConfig, len(auths))
+	for _, registry := range registries {
+		host := registryHost(registry)
+		// an exact host key beats one reduced from a URL
+		if _, exists := normalized[host]; !exists || host == registry {
+			normalized[host] = auths[registry]
+		}
+	}
+	return normalized
+}
+
+// dockerHubHost is the host the client sends Docker Hub requests to, and so the one it looks credentials up under.
+const dockerHubHost = "registry-1.docker.io"
+
+// registryHost reduces a registry URL key such as https://my.host/v1/ to its host. Keys without a scheme are left
+// alone, as they may name a namespace of the registry, such as quay.io/org. The names Docker uses for Docker Hub, such
+// as https://index.docker.io/v1/ and docker.io/org, are mapped to dockerHubHost.
+func registryHost(registry string) string {
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+		if i = strings.Index(registry, "/"); i >= 0 {
+			registry = registry[:i]
+		}
+	}
+	host, namespace := registry, ""
+	if i := strings.Index(registry, "/"); i >= 0 {
+		host, namespace = registry[:i], registry[i:]
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		return dockerHubHost + namespace
+	}
+	return registry
+}
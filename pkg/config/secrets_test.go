@@ -0,0 +1,140 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+)
+
+func writeSecret(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal("failed to write secret", err)
+	}
+	return path
+}
+
+func TestLoadPullSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-secrets")
+	if err != nil {
+		t.Fatal("failed to create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	mounted := filepath.Join(dir, "mounted")
+	os.Mkdir(mounted, 0700)
+	writeSecret(t, mounted, DockerConfigJSONKey, `{"auths":{"my.host":{"auth":"bXk6aG9zdA=="},"shared.io":{"username":"first","password":"a"}}}`)
+	legacy := writeSecret(t, dir, DockerCfgKey, `{"https://old.host/v1/":{"auth":"b2xkOmhvc3Q=","email":"me@old.host"},"shared.io":{"username":"second","password":"b"}}`)
+
+	t.Run("merged", func(t *testing.T) {
+		cfg, err := LoadPullSecrets(mounted, legacy)
+		if cfg == nil || err != nil {
+			t.Fatalf("expected config and nil error; got %v", err)
+		}
+		if len(cfg.AuthConfigs) != 3 {
+			t.Errorf("expected 3 auth configs; got %d", len(cfg.AuthConfigs))
+		}
+		if cfg.AuthConfigs["my.host"].Auth != "bXk6aG9zdA==" {
+			t.Errorf("expected my.host auth; got %+v", cfg.AuthConfigs["my.host"])
+		}
+		if cfg.AuthConfigs["old.host"].Auth != "b2xkOmhvc3Q=" {
+			t.Errorf("expected old.host auth from the legacy secret; got %+v", cfg.AuthConfigs["old.host"])
+		}
+		if cfg.AuthConfigs["shared.io"].Username != "first" {
+			t.Errorf("expected the first secret to win; got %+v", cfg.AuthConfigs["shared.io"])
+		}
+	})
+
+	t.Run("reversed", func(t *testing.T) {
+		cfg, err := LoadPullSecrets(legacy, mounted)
+		if err != nil || cfg.AuthConfigs["shared.io"].Username != "second" {
+			t.Errorf("expected the legacy secret to win; got %+v and %v", cfg, err)
+		}
+	})
+
+	t.Run("no secret in directory", func(t *testing.T) {
+		_, err := LoadPullSecrets(filepath.Join(dir, "mounted"), dir+"/nothing")
+		if err == nil || !strings.Contains(err.Error(), "nothing") {
+			t.Errorf("expected no such file; got %v", err)
+		}
+		empty := filepath.Join(dir, "empty")
+		os.Mkdir(empty, 0700)
+		if _, err = LoadPullSecrets(empty); err == nil || !strings.Contains(err.Error(), "no .dockerconfigjson or .dockercfg") {
+			t.Errorf("expected no .dockerconfigjson or .dockercfg; got %v", err)
+		}
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		path := writeSecret(t, dir, "bad", "rubbish")
+		if _, err := LoadPullSecrets(path); err == nil || !strings.Contains(err.Error(), "invalid character") {
+			t.Errorf("expected invalid character; got %v", err)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		cfg, err := LoadPullSecrets()
+		if err != nil || cfg == nil || len(cfg.AuthConfigs) != 0 {
+			t.Errorf("expected an empty config; got %+v and %v", cfg, err)
+		}
+	})
+}
+
+func TestParsePullSecret(t *testing.T) {
+	t.Run("docker hub keys", func(t *testing.T) {
+		// map iteration order varies, so parse a few times to catch a precedence that depends on it
+		for i := 0; i < 20; i++ {
+			auths, err := parsePullSecret([]byte(`{"auths":{"https://index.docker.io/v1/":{"username":"url"},"docker.io":{"username":"short"}}}`))
+			if err != nil || auths["registry-1.docker.io"].Username != "short" {
+				t.Fatalf("expected the docker.io key to win; got %+v and %v", auths, err)
+			}
+		}
+	})
+
+	t.Run("exact host", func(t *testing.T) {
+		auths, err := parsePullSecret([]byte(`{"auths":{"docker.io":{"username":"short"},"registry-1.docker.io":{"username":"exact"}}}`))
+		if err != nil || auths["registry-1.docker.io"].Username != "exact" {
+			t.Errorf("expected the exact host key to win; got %+v and %v", auths, err)
+		}
+	})
+}
+
+func TestRegistryHost(t *testing.T) {
+	for key, expected := range map[string]string{
+		"https://my.host/v1/":         "my.host",
+		"my.host:5000":                "my.host:5000",
+		"quay.io/org":                 "quay.io/org",
+		"https://index.docker.io/v1/": "registry-1.docker.io",
+		"index.docker.io":             "registry-1.docker.io",
+		"docker.io/org":               "registry-1.docker.io/org",
+		"registry-1.docker.io":        "registry-1.docker.io",
+	} {
+		if host := registryHost(key); host != expected {
+			t.Errorf("%s: expected %s; got %s", key, expected, host)
+		}
+	}
+}
+
+func TestMergeConfigs(t *testing.T) {
+	file := createTempFile(t)
+	defer os.Remove(file.Name())
+	file.Write([]byte(`{"auths":{"reg1":{"auth":"token"}}}`))
+	docker, err := CreateConfig(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ioutil.TempDir("", "pull-secrets")
+	defer os.RemoveAll(dir)
+	secrets, err := LoadPullSecrets(writeSecret(t, dir, DockerCfgKey, `{"reg1":{"auth":"other"},"reg2":{"auth":"two"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &configfile.ConfigFile{AuthConfigs: map[string]types.AuthConfig{"reg2": {}}}
+	merged := MergeConfigs(store, docker, nil, secrets)
+	if merged.AuthConfigs["reg1"].Auth != "token" || merged.AuthConfigs["reg2"].Auth != "two" {
+		t.Errorf("expected reg1 from the docker config and reg2 from the secret, not the empty auth; got %+v", merged.AuthConfigs)
+	}
+}
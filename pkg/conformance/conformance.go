@@ -0,0 +1,368 @@
+// Package conformance checks which parts of the distribution spec a registry supports, by running pull, push,
+// content discovery and content management workflows against it with the client.
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/vleurgat/dockerclient/pkg/client"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// Pass means the registry behaved as the spec requires.
+	Pass Status = "pass"
+	// Fail means the registry misbehaved.
+	Fail Status = "fail"
+	// Unsupported means the registry declined the operation, which the spec allows for optional features.
+	Unsupported Status = "unsupported"
+	// Skipped means the check wasn't run because a check it depends on didn't pass.
+	Skipped Status = "skipped"
+)
+
+// Categories of checks, following the workflows of the distribution spec.
+const (
+	Pull       = "pull"
+	Push       = "push"
+	Discovery  = "content discovery"
+	Management = "content management"
+)
+
+// Result is the outcome of a single capability check.
+type Result struct {
+	Category   string `json:"category"`
+	Capability string `json:"capability"`
+	Status     Status `json:"status"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Report is the outcome of running the suite against a registry.
+type Report struct {
+	Target  string    `json:"target"`
+	Started time.Time `json:"started"`
+	Results []Result  `json:"results"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Passed reports whether no check failed.
+func (r Report) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// check is a single capability check. Its run function returns an error for a failure, and unsupported for an
+// optional feature the registry declined. The check is skipped unless each of the push capabilities it depends on
+// passed.
+type check struct {
+	category   string
+	capability string
+	dependsOn  []string
+	run        func(s *suite) error
+}
+
+// unsupported wraps an error from the registry to mark the feature as unsupported rather than broken.
+type unsupported struct {
+	err error
+}
+
+func (u unsupported) Error() string {
+	return u.err.Error()
+}
+
+// optional marks errors with the status codes registries use for features they don't implement as unsupported.
+func optional(err error) error {
+	if statusErr, ok := err.(client.StatusError); ok {
+		switch statusErr.StatusCode {
+		case 400, 404, 405, 501:
+			return unsupported{err}
+		}
+	}
+	return err
+}
+
+// artifactType is the type of the artifact pushed to check the referrers API.
+const artifactType = "application/vnd.dockerclient.conformance"
+
+// suite holds what the checks have pushed so far.
+type suite struct {
+	client   *client.Client
+	repo     client.Reference
+	config   []byte
+	layer    []byte
+	manifest client.Manifest
+	index    client.Manifest
+	artifact v1.Descriptor
+}
+
+var checks = []check{
+	{Push, "blob upload", nil, (*suite).pushBlobs},
+	{Push, "manifest by tag", []string{"blob upload"}, (*suite).pushManifest},
+	{Push, "manifest by digest", []string{"blob upload"}, (*suite).pushManifestByDigest},
+	{Push, "image index", []string{"manifest by tag"}, (*suite).pushIndex},
+	{Pull, "manifest by tag", []string{"manifest by tag"}, (*suite).pullManifest},
+	{Pull, "manifest by digest", []string{"manifest by tag"}, (*suite).pullManifestByDigest},
+	{Pull, "manifest head", []string{"manifest by tag"}, (*suite).headManifest},
+	{Pull, "blob", []string{"blob upload"}, (*suite).pullBlob},
+	{Pull, "missing manifest", nil, (*suite).pullMissingManifest},
+	{Discovery, "tags list", []string{"manifest by tag"}, (*suite).listTags},
+	{Discovery, "referrers", []string{"manifest by tag"}, (*suite).listReferrers},
+	{Management, "delete tag", []string{"image index"}, (*suite).deleteTag},
+	{Management, "delete manifest", []string{"manifest by tag"}, (*suite).deleteManifest},
+}
+
+// Run runs every check against the repository of target, which may be a registry manifest URL or a Docker style
+// image name. The checks push small images and artifacts to the repository and delete them again where the registry
+// allows it, so the repository should be one set aside for the purpose. The conformance command runs it against an
+// in-process registrytest.Registry when it isn't given a target.
+func Run(c *client.Client, target string) Report {
+	report := Report{Target: target, Started: time.Now().UTC()}
+	repo, err := client.ParseReference(target)
+	if target == "" {
+		err = errors.New("no target registry given")
+	}
+	if err != nil {
+		report.Results = append(report.Results, Result{Category: Push, Capability: "target", Status: Fail, Message: err.Error()})
+		return report
+	}
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+	s := &suite{
+		client: c,
+		repo:   repo,
+		config: []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]},"nonce":"` + nonce + `"}`),
+		layer:  []byte("conformance layer " + nonce),
+	}
+	passed := make(map[string]bool)
+	for _, check := range checks {
+		result := s.run(check, passed)
+		if result.Status == Pass && check.category == Push {
+			passed[check.capability] = true
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func (s *suite) run(check check, passed map[string]bool) Result {
+	result := Result{Category: check.category, Capability: check.capability}
+	for _, dependency := range check.dependsOn {
+		if !passed[dependency] {
+			result.Status = Skipped
+			result.Message = "depends on " + dependency
+			return result
+		}
+	}
+	err := check.run(s)
+	switch err.(type) {
+	case nil:
+		result.Status = Pass
+	case unsupported:
+		result.Status = Unsupported
+		result.Message = err.Error()
+	default:
+		result.Status = Fail
+		result.Message = err.Error()
+	}
+	return result
+}
+
+func (s *suite) pushBlobs() error {
+	for _, blob := range [][]byte{s.config, s.layer} {
+		if _, err := s.client.PutBlob(s.repo, "application/octet-stream", blob); err != nil {
+			return err
+		}
+		exists, err := s.client.BlobExists(s.repo, digest.FromBytes(blob))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("uploaded blob does not exist")
+		}
+	}
+	return nil
+}
+
+func (s *suite) imageManifest() (client.Manifest, error) {
+	manifest := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    descriptor(schema2.MediaTypeImageConfig, s.config),
+		Layers:    []distribution.Descriptor{descriptor(schema2.MediaTypeLayer, s.layer)},
+	}
+	payload, err := json.Marshal(manifest)
+	return client.Manifest{MediaType: schema2.MediaTypeManifest, Digest: digest.FromBytes(payload), Payload: payload}, err
+}
+
+func (s *suite) pushManifest() error {
+	manifest, err := s.imageManifest()
+	if err != nil {
+		return err
+	}
+	if err = s.client.PutManifest(s.repo.WithTag("conformance").ManifestURL(), manifest); err != nil {
+		return err
+	}
+	s.manifest = manifest
+	return nil
+}
+
+func (s *suite) pushManifestByDigest() error {
+	manifest, err := s.imageManifest()
+	if err != nil {
+		return err
+	}
+	return s.client.PutManifest(s.repo.WithDigest(manifest.Digest).ManifestURL(), manifest)
+}
+
+func (s *suite) pushIndex() error {
+	index, err := s.client.PushIndex(s.repo.WithTag("conformance-index").ManifestURL(), v1.MediaTypeImageIndex,
+		s.repo.WithDigest(s.manifest.Digest).ManifestURL())
+	if err != nil {
+		return optional(err)
+	}
+	s.index = index
+	return nil
+}
+
+func (s *suite) pullManifest() error {
+	manifest, err := s.client.GetManifest(s.repo.WithTag("conformance").ManifestURL())
+	if err != nil {
+		return err
+	}
+	if manifest.Digest != s.manifest.Digest || manifest.MediaType != s.manifest.MediaType {
+		return errors.New("pulled " + manifest.MediaType + " " + manifest.Digest.String() + " but pushed " +
+			s.manifest.MediaType + " " + s.manifest.Digest.String())
+	}
+	return nil
+}
+
+func (s *suite) pullManifestByDigest() error {
+	manifest, err := s.client.GetManifest(s.repo.WithDigest(s.manifest.Digest).ManifestURL())
+	if err != nil {
+		return err
+	}
+	if manifest.Digest != s.manifest.Digest {
+		return errors.New("pulled " + manifest.Digest.String() + " but pushed " + s.manifest.Digest.String())
+	}
+	return nil
+}
+
+func (s *suite) headManifest() error {
+	descriptor, err := s.client.HeadManifest(s.repo.WithTag("conformance").ManifestURL())
+	if err != nil {
+		return err
+	}
+	if descriptor.Digest != s.manifest.Digest {
+		return errors.New("Docker-Content-Digest is " + descriptor.Digest.String() + " but pushed " + s.manifest.Digest.String())
+	}
+	return nil
+}
+
+func (s *suite) pullBlob() error {
+	d := digest.FromBytes(s.layer)
+	blob, err := s.client.GetBlob(s.repo.BlobURL(d))
+	if err != nil {
+		return err
+	}
+	if digest.FromBytes(blob) != d {
+		return errors.New("pulled blob does not match " + d.String())
+	}
+	return nil
+}
+
+func (s *suite) pullMissingManifest() error {
+	_, err := s.client.HeadManifest(s.repo.WithTag("conformance-missing").ManifestURL())
+	if client.IsNotFound(err) {
+		return nil
+	}
+	if err == nil {
+		return errors.New("found a manifest that was never pushed")
+	}
+	return errors.New("expected status code 404 - " + err.Error())
+}
+
+func (s *suite) listTags() error {
+	tags, err := s.client.ListTags(s.repo)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if tag == "conformance" {
+			return nil
+		}
+	}
+	return errors.New("pushed tag is not listed")
+}
+
+// listReferrers pushes an artifact with the manifest as its subject and asks the referrers API for it. The client's
+// ListReferrers falls back to the referrers tag schema, so the API is called directly to see whether it exists.
+func (s *suite) listReferrers() error {
+	subject := &v1.Descriptor{MediaType: s.manifest.MediaType, Digest: s.manifest.Digest, Size: int64(len(s.manifest.Payload))}
+	artifact, err := s.client.PushArtifact(s.repo.WithTag(""), client.Artifact{
+		ArtifactType: artifactType,
+		Blobs:        []client.ArtifactBlob{{MediaType: v1.MediaTypeEmptyJSON, Content: []byte("{}")}},
+		Subject:      subject,
+	})
+	if err != nil {
+		return optional(err)
+	}
+	s.artifact = artifact
+	referrers, err := s.client.ListReferrersFromAPI(s.repo, s.manifest.Digest, artifactType)
+	if err != nil {
+		return optional(err)
+	}
+	for _, referrer := range referrers {
+		if referrer.Digest == artifact.Digest {
+			return nil
+		}
+	}
+	return errors.New("pushed artifact is not listed as a referrer")
+}
+
+func (s *suite) deleteTag() error {
+	if err := s.client.DeleteManifest(s.repo.WithTag("conformance-index").ManifestURL()); err != nil {
+		return optional(err)
+	}
+	_, err := s.client.HeadManifest(s.repo.WithTag("conformance-index").ManifestURL())
+	if !client.IsNotFound(err) {
+		return errors.New("tag still exists after delete")
+	}
+	return nil
+}
+
+func (s *suite) deleteManifest() error {
+	for _, d := range []digest.Digest{s.artifact.Digest, s.index.Digest} {
+		if d != "" {
+			s.client.DeleteManifest(s.repo.WithDigest(d).ManifestURL())
+		}
+	}
+	if err := s.client.DeleteManifest(s.repo.WithDigest(s.manifest.Digest).ManifestURL()); err != nil {
+		return optional(err)
+	}
+	_, err := s.client.HeadManifest(s.repo.WithTag("conformance").ManifestURL())
+	if !client.IsNotFound(err) {
+		return errors.New("manifest still exists after delete")
+	}
+	return nil
+}
+
+func descriptor(mediaType string, content []byte) distribution.Descriptor {
+	return distribution.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+}
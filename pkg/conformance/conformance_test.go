@@ -0,0 +1,115 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/vleurgat/dockerclient/pkg/client"
+	"github.com/vleurgat/dockerclient/pkg/registrytest"
+)
+
+func statuses(report Report) map[string]Status {
+	result := make(map[string]Status)
+	for _, r := range report.Results {
+		result[r.Category+"/"+r.Capability] = r.Status
+	}
+	return result
+}
+
+func TestRun(t *testing.T) {
+	c := client.CreateClient(nil)
+
+	t.Run("fake registry", func(t *testing.T) {
+		registry := registrytest.CreateRegistry()
+		defer registry.Close()
+		report := Run(&c, registry.ManifestURL("conformance", "latest"))
+		if len(report.Results) != len(checks) {
+			t.Fatalf("expected %d results; got %+v", len(checks), report.Results)
+		}
+		for _, result := range report.Results {
+			if result.Status != Pass {
+				t.Errorf("expected %s %s to pass; got %s %s", result.Category, result.Capability, result.Status, result.Message)
+			}
+		}
+		if !report.Passed() {
+			t.Error("expected the report to pass")
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		registry := registrytest.CreateRegistry()
+		defer registry.Close()
+		registry.AddFault(registrytest.Fault{Method: "DELETE", StatusCode: http.StatusMethodNotAllowed})
+		report := Run(&c, registry.ManifestURL("conformance", "latest"))
+		results := statuses(report)
+		for _, capability := range []string{"delete tag", "delete manifest"} {
+			if results[Management+"/"+capability] != Unsupported {
+				t.Errorf("expected %s to be unsupported; got %s", capability, results[Management+"/"+capability])
+			}
+		}
+		if !report.Passed() {
+			t.Errorf("expected the report to pass; got %+v", report.Results)
+		}
+	})
+
+	t.Run("no referrers API", func(t *testing.T) {
+		registry := registrytest.CreateRegistry()
+		defer registry.Close()
+		registry.AddFault(registrytest.Fault{Path: "/referrers/", StatusCode: http.StatusNotFound})
+		report := Run(&c, registry.ManifestURL("conformance", "latest"))
+		if status := statuses(report)[Discovery+"/referrers"]; status != Unsupported {
+			t.Errorf("expected referrers to be unsupported; got %s", status)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		registry := registrytest.CreateRegistry()
+		defer registry.Close()
+		registry.AddFault(registrytest.Fault{Method: "PUT", Path: "/manifests/conformance$", StatusCode: http.StatusInternalServerError})
+		report := Run(&c, registry.ManifestURL("conformance", "latest"))
+		results := statuses(report)
+		for capability, expected := range map[string]Status{
+			Push + "/blob upload":           Pass,
+			Push + "/manifest by tag":       Fail,
+			Push + "/manifest by digest":    Pass,
+			Pull + "/manifest by tag":       Skipped,
+			Discovery + "/tags list":        Skipped,
+			Management + "/delete tag":      Skipped,
+			Management + "/delete manifest": Skipped,
+		} {
+			if results[capability] != expected {
+				t.Errorf("expected %s to be %s; got %s", capability, expected, results[capability])
+			}
+		}
+		if report.Passed() {
+			t.Error("expected the report to fail")
+		}
+	})
+
+	t.Run("invalid target", func(t *testing.T) {
+		for _, target := range []string{"http://", ""} {
+			report := Run(&c, target)
+			if report.Passed() || len(report.Results) != 1 {
+				t.Errorf("%q: expected a single failure; got %+v", target, report.Results)
+			}
+		}
+	})
+}
+
+func TestWriteJSON(t *testing.T) {
+	report := Report{Target: "my.host/repo", Results: []Result{{Category: Pull, Capability: "blob", Status: Unsupported, Message: "no"}}}
+	var buffer bytes.Buffer
+	if err := report.WriteJSON(&buffer); err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid JSON; got %s", err)
+	}
+	results := decoded["results"].([]interface{})
+	if result := results[0].(map[string]interface{}); result["status"] != "unsupported" || result["capability"] != "blob" {
+		t.Errorf("expected the result to be encoded; got %v", result)
+	}
+}
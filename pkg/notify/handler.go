@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// EventsMediaType is the media type of the notification envelopes sent by the registry.
+const EventsMediaType = "application/vnd.docker.distribution.events.v1+json"
+
+// Actions of registry events.
+const (
+	ActionPush   = "push"
+	ActionPull   = "pull"
+	ActionMount  = "mount"
+	ActionDelete = "delete"
+)
+
+// maxSeen is the number of event IDs remembered for deduplication.
+const maxSeen = 10000
+
+// maxEnvelopeSize is the largest notification request body accepted, which is far more than the registry sends.
+const maxEnvelopeSize = 1 << 20
+
+// Envelope is the body of a notification request, which may hold several events.
+type Envelope struct {
+	Events []Event `json:"events"`
+}
+
+// Event is a single registry event.
+type Event struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Target    Target    `json:"target"`
+	Request   Request   `json:"request"`
+	Actor     Actor     `json:"actor"`
+	Source    Source    `json:"source"`
+}
+
+// Target is the manifest or blob that the event is about.
+type Target struct {
+	MediaType  string        `json:"mediaType,omitempty"`
+	Size       int64         `json:"size,omitempty"`
+	Digest     digest.Digest `json:"digest,omitempty"`
+	Length     int64         `json:"length,omitempty"`
+	Repository string        `json:"repository,omitempty"`
+	URL        string        `json:"url,omitempty"`
+	Tag        string        `json:"tag,omitempty"`
+}
+
+// Request describes the request that caused the event.
+type Request struct {
+	ID        string `json:"id,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Method    string `json:"method,omitempty"`
+	UserAgent string `json:"useragent,omitempty"`
+}
+
+// Actor is the user that caused the event.
+type Actor struct {
+	Name string `json:"name,omitempty"`
+}
+
+// Source is the registry instance that generated the event.
+type Source struct {
+	Addr       string `json:"addr,omitempty"`
+	InstanceID string `json:"instanceID,omitempty"`
+}
+
+// Handler is an http.Handler for the registry's notification endpoint. Each new event is passed to the callback; events
+// with an ID that has already been handled are dropped, since the registry retries deliveries it thinks have failed.
+// If the callback returns an error the request fails, so that the registry sends the envelope again.
+type Handler struct {
+	// Header is the request header holding the shared secret, which defaults to Authorization.
+	Header string
+
+	secret   string
+	callback func(Event) error
+	mutex    sync.Mutex
+	seen     map[string]bool
+	order    []string
+}
+
+// CreateHandler creates a Handler that only accepts requests whose secret header, as configured in the headers of the
+// registry's notification endpoint, matches the secret. An empty secret disables the check.
+func CreateHandler(secret string, callback func(Event) error) *Handler {
+	return &Handler{Header: "Authorization", secret: secret, callback: callback, seen: make(map[string]bool)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(h.Header)), []byte(h.secret)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != EventsMediaType && mediaType != "application/json" {
+		http.Error(w, "unsupported media type "+mediaType, http.StatusUnsupportedMediaType)
+		return
+	}
+	var envelope Envelope
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnvelopeSize)).Decode(&envelope); err != nil {
+		http.Error(w, "bad notification envelope - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, event := range envelope.Events {
+		// the ID is reserved before the callback runs, so that a concurrent redelivery of the event is dropped
+		if !h.reserve(event.ID) {
+			continue
+		}
+		if err := h.callback(event); err != nil {
+			h.release(event.ID)
+			log.Println("failed to handle registry event", event.ID, err)
+			http.Error(w, "failed to handle event "+event.ID, http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// reserve remembers the event ID, forgetting the oldest once there are too many, and reports whether it is new.
+// Events without an ID are always new.
+func (h *Handler) reserve(id string) bool {
+	if id == "" {
+		return true
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.seen[id] {
+		return false
+	}
+	h.seen[id] = true
+	h.order = append(h.order, id)
+	if len(h.order) > maxSeen {
+		delete(h.seen, h.order[0])
+		h.order = h.order[1:]
+	}
+	return true
+}
+
+// release forgets a reserved event ID, so that the event is handled when the registry sends it again.
+func (h *Handler) release(id string) {
+	if id == "" {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.seen[id] {
+		return
+	}
+	delete(h.seen, id)
+	for i := len(h.order) - 1; i >= 0; i-- {
+		if h.order[i] == id {
+			h.order = append(h.order[:i], h.order[i+1:]...)
+			break
+		}
+	}
+}
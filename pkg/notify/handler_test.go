@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const envelope = `{"events":[{
+	"id":"320678d8-ca14-430f-8bb6-4ca139cd83f7",
+	"timestamp":"2016-03-09T14:44:26.402973972-08:00",
+	"action":"push",
+	"target":{
+		"mediaType":"application/vnd.docker.distribution.manifest.v2+json",
+		"size":708,
+		"digest":"sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+		"length":708,
+		"repository":"hello-world",
+		"url":"http://192.168.100.227:5000/v2/hello-world/manifests/sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+		"tag":"latest"
+	},
+	"request":{"id":"6df24a34-0959-4923-81ca-14f09767db19","addr":"192.168.64.11:42961","host":"192.168.100.227:5000","method":"PUT","useragent":"curl/7.38.0"},
+	"actor":{"name":"bob"},
+	"source":{"addr":"xtal.local:5000","instanceID":"a53db899-3b4b-4a62-a067-8dd013beaca4"}
+}]}`
+
+func notification(body string, secret string) *http.Request {
+	request := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	request.Header.Set("Content-Type", EventsMediaType)
+	if secret != "" {
+		request.Header.Set("Authorization", secret)
+	}
+	return request
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("events", func(t *testing.T) {
+		var events []Event
+		handler := CreateHandler("Bearer s3cret", func(event Event) error {
+			events = append(events, event)
+			return nil
+		})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, notification(envelope, "Bearer s3cret"))
+		if response.Code != 200 {
+			t.Fatalf("expected 200; got %d", response.Code)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected 1 event; got %d", len(events))
+		}
+		event := events[0]
+		if event.Action != ActionPush || event.Target.Repository != "hello-world" || event.Target.Tag != "latest" {
+			t.Errorf("expected push of hello-world:latest; got %+v", event)
+		}
+		if event.Target.Digest.Validate() != nil || event.Actor.Name != "bob" || event.Timestamp.IsZero() {
+			t.Errorf("expected digest, actor and timestamp; got %+v", event)
+		}
+	})
+
+	t.Run("duplicates", func(t *testing.T) {
+		count := 0
+		handler := CreateHandler("", func(event Event) error {
+			count++
+			return nil
+		})
+		for i := 0; i < 2; i++ {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, notification(envelope, ""))
+			if response.Code != 200 {
+				t.Errorf("expected 200; got %d", response.Code)
+			}
+		}
+		if count != 1 {
+			t.Errorf("expected the event once; got %d", count)
+		}
+	})
+
+	t.Run("concurrent duplicates", func(t *testing.T) {
+		var count int32
+		started := make(chan bool)
+		finish := make(chan bool)
+		handler := CreateHandler("", func(event Event) error {
+			atomic.AddInt32(&count, 1)
+			started <- true
+			<-finish
+			return nil
+		})
+		done := make(chan int)
+		go func() {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, notification(envelope, ""))
+			done <- response.Code
+		}()
+		<-started
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, notification(envelope, ""))
+		close(finish)
+		if code := <-done; code != 200 || response.Code != 200 {
+			t.Errorf("expected 200 for both deliveries; got %d and %d", code, response.Code)
+		}
+		if count != 1 {
+			t.Errorf("expected the event once; got %d", count)
+		}
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		fail := true
+		count := 0
+		handler := CreateHandler("", func(event Event) error {
+			count++
+			if fail {
+				return errors.New("busy")
+			}
+			return nil
+		})
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, notification(envelope, ""))
+		if response.Code != 500 {
+			t.Errorf("expected 500; got %d", response.Code)
+		}
+		fail = false
+		response = httptest.NewRecorder()
+		handler.ServeHTTP(response, notification(envelope, ""))
+		if response.Code != 200 || count != 2 {
+			t.Errorf("expected the retry to be handled; got %d after %d calls", response.Code, count)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		handler := CreateHandler("Bearer s3cret", func(event Event) error {
+			t.Error("expected no events")
+			return nil
+		})
+		badType := notification(envelope, "Bearer s3cret")
+		badType.Header.Set("Content-Type", "text/plain")
+		for name, test := range map[string]struct {
+			request *http.Request
+			code    int
+		}{
+			"no secret":    {notification(envelope, ""), 401},
+			"wrong secret": {notification(envelope, "Bearer guess"), 401},
+			"bad json":     {notification("{", "Bearer s3cret"), 400},
+			"too large":    {notification(`{"events":[`+strings.Repeat(" ", maxEnvelopeSize)+`]}`, "Bearer s3cret"), 400},
+			"content type": {badType, 415},
+			"method":       {httptest.NewRequest("GET", "/events", nil), 405},
+		} {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, test.request)
+			if response.Code != test.code {
+				t.Errorf("%s: expected %d; got %d", name, test.code, response.Code)
+			}
+		}
+	})
+}
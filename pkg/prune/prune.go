@@ -0,0 +1,347 @@
+package prune
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/vleurgat/dockerclient/pkg/client"
+)
+
+// Registry is the part of client.Client that pruning uses.
+type Registry interface {
+	ListTags(repo client.Reference) ([]string, error)
+	HeadManifest(url string) (distribution.Descriptor, error)
+	GetManifest(url string) (client.Manifest, error)
+	GetImageConfig(url string) (v1.Image, error)
+	DeleteManifest(url string) error
+}
+
+// Policy holds the retention rules for a repository. A tag is kept if any rule keeps it; every other tag is deleted.
+// A policy needs at least one of KeepLast, KeepTags and OlderThan. Indexes and artifacts without a creation date, such
+// as the sha256-<hex> indexes of the referrers tag schema, are never deleted, since the policy can't age them, and
+// nor are tags whose image config can't be read.
+type Policy struct {
+	// KeepLast keeps the most recently created tags.
+	KeepLast int
+	// KeepTags keeps the tags matching any of these regular expressions.
+	KeepTags []string
+	// OlderThan, if set, keeps tags created more recently than this.
+	OlderThan time.Duration
+	// ProtectedTags are tags whose images are never deleted.
+	ProtectedTags []string
+}
+
+// Image is a manifest in the repository along with the tags that point at it.
+type Image struct {
+	Digest  digest.Digest
+	Tags    []string
+	Created time.Time
+	// Reason says why the image is kept or deleted.
+	Reason string
+}
+
+// Plan is the outcome of applying a Policy to a repository. Since deleting a manifest deletes all its tags, an image
+// is only deleted when the policy deletes every one of its tags. Nor is it deleted when a kept index lists it, or a
+// kept artifact has it as its subject.
+type Plan struct {
+	Repository client.Reference
+	Keep       []Image
+	Delete     []Image
+}
+
+type tagInfo struct {
+	tag       string
+	digest    digest.Digest
+	mediaType string
+	created   time.Time
+	// undated says why a tag without a creation date is kept
+	undated string
+}
+
+// CreatePlan lists the tags of the repository of repo, resolves their digests and creation dates and applies the
+// policy to them, without deleting anything.
+func CreatePlan(registry Registry, repo client.Reference, policy Policy) (Plan, error) {
+	if policy.KeepLast <= 0 && len(policy.KeepTags) == 0 && policy.OlderThan <= 0 {
+		return Plan{}, errors.New("policy has no retention rules - it would delete every tag")
+	}
+	keepTags := make(map[string]*regexp.Regexp)
+	for _, expr := range policy.KeepTags {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return Plan{}, err
+		}
+		keepTags[expr] = re
+	}
+	tags, err := registry.ListTags(repo)
+	if err != nil {
+		return Plan{}, err
+	}
+	var infos []tagInfo
+	resolved := make(map[digest.Digest]tagInfo)
+	for _, tag := range tags {
+		info, err := resolveTag(registry, repo, tag, resolved)
+		if client.IsNotFound(err) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return Plan{}, err
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].created.Equal(infos[j].created) {
+			return infos[i].tag < infos[j].tag
+		}
+		return infos[i].created.After(infos[j].created)
+	})
+	protected := make(map[string]bool)
+	for _, tag := range policy.ProtectedTags {
+		protected[tag] = true
+	}
+	now := time.Now()
+	images := make(map[digest.Digest]*Image)
+	kept := make(map[digest.Digest]bool)
+	mediaTypes := make(map[digest.Digest]string)
+	var order []digest.Digest
+	for i, info := range infos {
+		mediaTypes[info.digest] = info.mediaType
+		reason := keepReason(policy, keepTags, protected, info, i, now)
+		image, exists := images[info.digest]
+		if !exists {
+			image = &Image{Digest: info.digest, Created: info.created}
+			images[info.digest] = image
+			order = append(order, info.digest)
+		}
+		image.Tags = append(image.Tags, info.tag)
+		if reason != "" && !kept[info.digest] {
+			kept[info.digest] = true
+			image.Reason = info.tag + " " + reason
+		}
+	}
+	if err = keepReferenced(registry, repo, images, kept, mediaTypes); err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{Repository: repo}
+	for _, d := range order {
+		image := images[d]
+		if kept[d] {
+			plan.Keep = append(plan.Keep, *image)
+			continue
+		}
+		if policy.OlderThan > 0 {
+			image.Reason = "older than " + policy.OlderThan.String()
+		} else {
+			image.Reason = "not kept by any rule"
+		}
+		plan.Delete = append(plan.Delete, *image)
+	}
+	return plan, nil
+}
+
+// keepReferenced keeps the images that the kept images refer to: the manifests a kept index lists, and the subject of
+// a kept artifact. Without them an index would be left incomplete and an artifact would be left dangling. The
+// sha256-<hex> indexes of the referrers tag schema aren't followed, as they are kept whatever happens to their subject.
+func keepReferenced(registry Registry, repo client.Reference, images map[digest.Digest]*Image, kept map[digest.Digest]bool, mediaTypes map[digest.Digest]string) error {
+	var pending []digest.Digest
+	for d := range kept {
+		pending = append(pending, d)
+	}
+	followed := make(map[digest.Digest]bool)
+	for len(pending) > 0 {
+		d := pending[0]
+		pending = pending[1:]
+		if followed[d] || !mayRefer(mediaTypes[d]) || (images[d] != nil && isReferrersTagIndex(images[d].Tags)) {
+			continue
+		}
+		followed[d] = true
+		manifest, err := registry.GetManifest(repo.WithDigest(d).ManifestURL())
+		if client.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var references struct {
+			Manifests []v1.Descriptor `json:"manifests"`
+			Subject   *v1.Descriptor  `json:"subject"`
+		}
+		if err = json.Unmarshal(manifest.Payload, &references); err != nil {
+			return errors.New("failed to read the references of " + repo.WithDigest(d).String() + " - " + err.Error())
+		}
+		referenced := references.Manifests
+		reason := "is listed by " + d.String()
+		if references.Subject != nil {
+			referenced = append(referenced, *references.Subject)
+		}
+		for _, descriptor := range referenced {
+			if references.Subject != nil && descriptor.Digest == references.Subject.Digest {
+				reason = "is the subject of " + d.String()
+			}
+			if _, exists := mediaTypes[descriptor.Digest]; !exists {
+				mediaTypes[descriptor.Digest] = descriptor.MediaType
+			}
+			if image, exists := images[descriptor.Digest]; exists && !kept[descriptor.Digest] {
+				image.Reason = strings.Join(image.Tags, ",") + " " + reason
+			}
+			kept[descriptor.Digest] = true
+			pending = append(pending, descriptor.Digest)
+		}
+	}
+	return nil
+}
+
+// mayRefer reports whether a manifest of the media type can list other manifests or have a subject. Docker's image
+// manifests can do neither, so aren't fetched.
+func mayRefer(mediaType string) bool {
+	switch mediaType {
+	case v1.MediaTypeImageIndex, manifestlist.MediaTypeManifestList, v1.MediaTypeImageManifest, "":
+		return true
+	}
+	return false
+}
+
+// isReferrersTagIndex reports whether the tags are those of a referrers tag schema index, which are named after the
+// digest of their subject.
+func isReferrersTagIndex(tags []string) bool {
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "sha256-") {
+			return false
+		}
+	}
+	return len(tags) > 0
+}
+
+// resolveTag returns the digest and creation date of the tag, remembering the digests seen so far so that each config
+// is only fetched once. A tag whose config can't be read, such as a schema1 image or an artifact with a config that
+// isn't JSON, is marked as undated rather than failing the whole plan.
+func resolveTag(registry Registry, repo client.Reference, tag string, resolved map[digest.Digest]tagInfo) (tagInfo, error) {
+	url := repo.WithTag(tag).ManifestURL()
+	descriptor, err := registry.HeadManifest(url)
+	if err != nil {
+		return tagInfo{}, err
+	}
+	if descriptor.Digest == "" {
+		return tagInfo{}, errors.New("registry did not return a digest for " + repo.WithTag(tag).String())
+	}
+	if info, exists := resolved[descriptor.Digest]; exists {
+		info.tag = tag
+		return info, nil
+	}
+	info := tagInfo{tag: tag, digest: descriptor.Digest, mediaType: descriptor.MediaType}
+	config, err := registry.GetImageConfig(repo.WithDigest(descriptor.Digest).ManifestURL())
+	switch {
+	case err != nil:
+		info.undated = "has an image config that can't be read"
+	case config.Created != nil:
+		info.created = *config.Created
+	default:
+		// an artifact's config isn't an image config, so has no OS
+		index := descriptor.MediaType == v1.MediaTypeImageIndex || descriptor.MediaType == manifestlist.MediaTypeManifestList
+		if index || config.OS == "" {
+			info.undated = "is an index or artifact with no creation date"
+		}
+	}
+	resolved[descriptor.Digest] = info
+	return info, nil
+}
+
+// keepReason returns why the policy keeps the tag, which is the rank-th most recently created, or an empty string if
+// it doesn't.
+func keepReason(policy Policy, keepTags map[string]*regexp.Regexp, protected map[string]bool, info tagInfo, rank int, now time.Time) string {
+	if protected[info.tag] {
+		return "is protected"
+	}
+	if info.undated != "" {
+		return info.undated
+	}
+	for _, expr := range policy.KeepTags {
+		if keepTags[expr].MatchString(info.tag) {
+			return "matches " + expr
+		}
+	}
+	if rank < policy.KeepLast {
+		return "is one of the last " + strconv.Itoa(policy.KeepLast)
+	}
+	if policy.OlderThan > 0 && now.Sub(info.created) < policy.OlderThan {
+		return "is newer than " + policy.OlderThan.String()
+	}
+	return ""
+}
+
+// Execute deletes the images in the plan's Delete list by digest, stopping at the first failure. It returns the
+// images that were deleted. The repository's tags are listed and resolved again first, and an image is skipped if
+// any of its tags no longer points at it, or another tag now does, since deleting the manifest would delete that tag
+// too.
+func (p Plan) Execute(registry Registry) ([]Image, error) {
+	current, err := currentTags(registry, p.Repository)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []Image
+	for _, image := range p.Delete {
+		if changed := changedTag(current, image); changed != "" {
+			log.Println("skipped", p.Repository.WithDigest(image.Digest), "as", changed, "has changed since the plan was made")
+			continue
+		}
+		if err := registry.DeleteManifest(p.Repository.WithDigest(image.Digest).ManifestURL()); err != nil {
+			return deleted, err
+		}
+		log.Println("deleted", p.Repository.WithDigest(image.Digest), image.Tags, image.Reason)
+		deleted = append(deleted, image)
+	}
+	return deleted, nil
+}
+
+// currentTags returns the digest each tag of the repository points at now.
+func currentTags(registry Registry, repo client.Reference) (map[string]digest.Digest, error) {
+	tags, err := registry.ListTags(repo)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]digest.Digest)
+	for _, tag := range tags {
+		descriptor, err := registry.HeadManifest(repo.WithTag(tag).ManifestURL())
+		if client.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		current[tag] = descriptor.Digest
+	}
+	return current, nil
+}
+
+// changedTag returns a tag that has changed for the image, either one of its own that no longer points at it or
+// another that now does, or an empty string if none have.
+func changedTag(current map[string]digest.Digest, image Image) string {
+	own := make(map[string]bool)
+	for _, tag := range image.Tags {
+		own[tag] = true
+		if current[tag] != image.Digest {
+			return tag
+		}
+	}
+	var added []string
+	for tag, d := range current {
+		if d == image.Digest && !own[tag] {
+			added = append(added, tag)
+		}
+	}
+	if len(added) == 0 {
+		return ""
+	}
+	sort.Strings(added)
+	return added[0]
+}
@@ -0,0 +1,302 @@
+package prune
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/vleurgat/dockerclient/pkg/client"
+	"github.com/vleurgat/dockerclient/pkg/registrytest"
+)
+
+// fakeRegistry holds tags pointing at digests, each with a creation date, along with the payloads of any manifests
+// that refer to others.
+type fakeRegistry struct {
+	tags       map[string]digest.Digest
+	created    map[digest.Digest]time.Time
+	manifests  map[digest.Digest]string
+	unreadable map[digest.Digest]bool
+	deleted    []string
+	fail       bool
+}
+
+func (r *fakeRegistry) ListTags(repo client.Reference) ([]string, error) {
+	var tags []string
+	for tag := range r.tags {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (r *fakeRegistry) HeadManifest(url string) (distribution.Descriptor, error) {
+	ref, _ := client.ParseReference(url)
+	d, exists := r.tags[ref.Tag]
+	if !exists {
+		return distribution.Descriptor{}, client.StatusError{StatusCode: 404}
+	}
+	descriptor := distribution.Descriptor{Digest: d, MediaType: schema2.MediaTypeManifest}
+	if strings.HasPrefix(ref.Tag, "sha256-") {
+		descriptor.MediaType = v1.MediaTypeImageIndex
+	} else if _, exists := r.manifests[d]; exists {
+		descriptor.MediaType = v1.MediaTypeImageManifest
+	}
+	return descriptor, nil
+}
+
+func (r *fakeRegistry) GetManifest(url string) (client.Manifest, error) {
+	d := digest.Digest(url[strings.LastIndex(url, "/")+1:])
+	payload, exists := r.manifests[d]
+	if !exists {
+		return client.Manifest{}, client.StatusError{StatusCode: 404}
+	}
+	return client.Manifest{MediaType: v1.MediaTypeImageManifest, Digest: d, Payload: []byte(payload)}, nil
+}
+
+func (r *fakeRegistry) GetImageConfig(url string) (v1.Image, error) {
+	d := digest.Digest(url[strings.LastIndex(url, "/")+1:])
+	if r.unreadable[d] {
+		return v1.Image{}, errors.New("config is not JSON")
+	}
+	created, exists := r.created[d]
+	if !exists {
+		return v1.Image{}, nil
+	}
+	return v1.Image{Created: &created}, nil
+}
+
+func (r *fakeRegistry) DeleteManifest(url string) error {
+	if r.fail {
+		return errors.New("delete not allowed")
+	}
+	r.deleted = append(r.deleted, url)
+	return nil
+}
+
+func createRegistry() *fakeRegistry {
+	now := time.Now()
+	day := 24 * time.Hour
+	return &fakeRegistry{
+		tags: map[string]digest.Digest{
+			"ci-5":    "sha256:5",
+			"ci-4":    "sha256:4",
+			"ci-3":    "sha256:3",
+			"stable":  "sha256:2",
+			"ci-2":    "sha256:2",
+			"ci-1":    "sha256:1",
+			"release": "sha256:0",
+		},
+		created: map[digest.Digest]time.Time{
+			"sha256:5": now.Add(-1 * day),
+			"sha256:4": now.Add(-2 * day),
+			"sha256:3": now.Add(-3 * day),
+			"sha256:2": now.Add(-10 * day),
+			"sha256:1": now.Add(-20 * day),
+			"sha256:0": now.Add(-30 * day),
+		},
+	}
+}
+
+func digests(images []Image) string {
+	var result []string
+	for _, image := range images {
+		result = append(result, image.Digest.String())
+	}
+	return strings.Join(result, ",")
+}
+
+func TestCreatePlan(t *testing.T) {
+	repo, _ := client.ParseReference("my.host/repo")
+
+	t.Run("keep last", func(t *testing.T) {
+		plan, err := CreatePlan(createRegistry(), repo, Policy{KeepLast: 2})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:5,sha256:4" || digests(plan.Delete) != "sha256:3,sha256:2,sha256:1,sha256:0" {
+			t.Errorf("unexpected plan; got %+v", plan)
+		}
+	})
+
+	t.Run("keep regex", func(t *testing.T) {
+		plan, err := CreatePlan(createRegistry(), repo, Policy{KeepTags: []string{"release|ci-[34]"}})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:4,sha256:3,sha256:0" {
+			t.Errorf("unexpected plan; got %+v", plan)
+		}
+		if plan.Keep[2].Reason != "release matches release|ci-[34]" {
+			t.Errorf("unexpected reason; got %s", plan.Keep[2].Reason)
+		}
+	})
+
+	t.Run("older than", func(t *testing.T) {
+		plan, err := CreatePlan(createRegistry(), repo, Policy{OlderThan: 7 * 24 * time.Hour})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:5,sha256:4,sha256:3" || digests(plan.Delete) != "sha256:2,sha256:1,sha256:0" {
+			t.Errorf("unexpected plan; got %+v", plan)
+		}
+		if !strings.HasPrefix(plan.Delete[0].Reason, "older than") {
+			t.Errorf("unexpected reason; got %s", plan.Delete[0].Reason)
+		}
+	})
+
+	t.Run("protected", func(t *testing.T) {
+		plan, err := CreatePlan(createRegistry(), repo, Policy{KeepLast: 1, ProtectedTags: []string{"stable"}})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:5,sha256:2" {
+			t.Fatalf("unexpected plan; got %+v", plan)
+		}
+		if strings.Join(plan.Keep[1].Tags, ",") != "ci-2,stable" {
+			t.Errorf("expected both tags of the protected image; got %s", plan.Keep[1].Tags)
+		}
+	})
+
+	t.Run("no rules", func(t *testing.T) {
+		_, err := CreatePlan(createRegistry(), repo, Policy{ProtectedTags: []string{"stable"}})
+		if err == nil || !strings.Contains(err.Error(), "no retention rules") {
+			t.Errorf("expected no retention rules; got %v", err)
+		}
+	})
+
+	t.Run("undated index", func(t *testing.T) {
+		registry := createRegistry()
+		registry.tags["sha256-5"] = "sha256:referrers"
+		plan, err := CreatePlan(registry, repo, Policy{KeepLast: 1})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:5,sha256:referrers" {
+			t.Fatalf("expected the referrers index to be kept; got %+v", plan)
+		}
+		if plan.Keep[1].Reason != "sha256-5 is an index or artifact with no creation date" {
+			t.Errorf("unexpected reason; got %s", plan.Keep[1].Reason)
+		}
+	})
+
+	t.Run("unreadable config", func(t *testing.T) {
+		registry := createRegistry()
+		registry.unreadable = map[digest.Digest]bool{"sha256:1": true}
+		plan, err := CreatePlan(registry, repo, Policy{KeepLast: 1})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:5,sha256:1" || plan.Keep[1].Reason != "ci-1 has an image config that can't be read" {
+			t.Errorf("expected ci-1 to be kept; got %+v", plan)
+		}
+	})
+
+	t.Run("artifact subject", func(t *testing.T) {
+		registry := createRegistry()
+		registry.tags["signature"] = "sha256:signature"
+		registry.created["sha256:signature"] = time.Now()
+		registry.manifests = map[digest.Digest]string{"sha256:signature": `{"subject":{"digest":"sha256:1"}}`}
+		plan, err := CreatePlan(registry, repo, Policy{KeepLast: 1})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if digests(plan.Keep) != "sha256:signature,sha256:1" || plan.Keep[1].Reason != "ci-1 is the subject of sha256:signature" {
+			t.Errorf("expected the subject of the signature to be kept; got %+v", plan)
+		}
+	})
+
+	t.Run("bad regex", func(t *testing.T) {
+		_, err := CreatePlan(createRegistry(), repo, Policy{KeepTags: []string{"("}})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestCreatePlanIndex(t *testing.T) {
+	registry := registrytest.CreateRegistry()
+	defer registry.Close()
+	c := client.CreateClient(nil)
+	for i, arch := range []string{"amd64", "arm64"} {
+		config := []byte(`{"os":"linux","architecture":"` + arch + `","created":"2020-01-0` + strconv.Itoa(i+1) + `T00:00:00Z"}`)
+		m := schema2.Manifest{
+			Versioned: schema2.SchemaVersion,
+			Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: registry.PutBlob("repo", config), Size: int64(len(config))},
+		}
+		payload, _ := json.Marshal(m)
+		registry.PutManifest("repo", "ci-"+arch, schema2.MediaTypeManifest, payload)
+	}
+	if _, err := c.PushIndex(registry.ManifestURL("repo", "stable"), "",
+		registry.ManifestURL("repo", "ci-amd64"), registry.ManifestURL("repo", "ci-arm64")); err != nil {
+		t.Fatalf("failed to push index - %s", err)
+	}
+	repo, _ := client.ParseReference(registry.ManifestURL("repo", "stable"))
+	plan, err := CreatePlan(&c, repo.WithTag(""), Policy{KeepLast: 1, ProtectedTags: []string{"stable"}})
+	if err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	if len(plan.Delete) != 0 || len(plan.Keep) != 3 {
+		t.Fatalf("expected the images of the index to be kept; got %+v", plan)
+	}
+	if _, err = plan.Execute(&c); err != nil {
+		t.Fatalf("expected nil error; got %s", err)
+	}
+	if _, err = c.GetImageConfig(registry.ManifestURL("repo", "ci-amd64")); err != nil {
+		t.Errorf("expected ci-amd64 to remain; got %s", err)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	repo, _ := client.ParseReference("my.host/repo")
+
+	t.Run("deletes by digest", func(t *testing.T) {
+		registry := createRegistry()
+		plan, _ := CreatePlan(registry, repo, Policy{KeepLast: 6})
+		deleted, err := plan.Execute(registry)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if len(deleted) != 1 || strings.Join(registry.deleted, ",") != "https://my.host/v2/repo/manifests/sha256:0" {
+			t.Errorf("expected sha256:0 to be deleted; got %s", registry.deleted)
+		}
+	})
+
+	t.Run("moved tag", func(t *testing.T) {
+		registry := createRegistry()
+		plan, _ := CreatePlan(registry, repo, Policy{KeepLast: 5})
+		registry.tags["ci-1"] = "sha256:5"
+		deleted, err := plan.Execute(registry)
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if len(deleted) != 1 || strings.Join(registry.deleted, ",") != "https://my.host/v2/repo/manifests/sha256:0" {
+			t.Errorf("expected only sha256:0 to be deleted; got %s", registry.deleted)
+		}
+	})
+
+	t.Run("added tag", func(t *testing.T) {
+		registry := createRegistry()
+		plan, _ := CreatePlan(registry, repo, Policy{KeepLast: 5})
+		registry.tags["promoted"] = "sha256:0"
+		deleted, err := plan.Execute(registry)
+		if err != nil || len(deleted) != 1 || strings.Join(registry.deleted, ",") != "https://my.host/v2/repo/manifests/sha256:1" {
+			t.Errorf("expected only sha256:1 to be deleted; got %s and %v", registry.deleted, err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		registry := createRegistry()
+		plan, _ := CreatePlan(registry, repo, Policy{KeepLast: 1})
+		registry.fail = true
+		deleted, err := plan.Execute(registry)
+		if err == nil || len(deleted) != 0 {
+			t.Errorf("expected an error and nothing deleted; got %s and %d", err, len(deleted))
+		}
+	})
+}
@@ -0,0 +1,733 @@
+// Package registrytest provides an in-memory registry, served by an httptest.Server, for testing code that talks to
+// a registry without any network access.
+package registrytest
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Service is the service name the registry uses in its bearer challenges.
+const Service = "registrytest"
+
+var (
+	manifestPath  = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+	uploadPath    = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/([^/]*)$`)
+	blobPath      = regexp.MustCompile(`^/v2/(.+)/blobs/([^/]+)$`)
+	tagsPath      = regexp.MustCompile(`^/v2/(.+)/tags/list$`)
+	referrersPath = regexp.MustCompile(`^/v2/(.+)/referrers/([^/]+)$`)
+)
+
+// Registry is an in-memory implementation of the distribution API, covering manifests, blobs, uploads, tags, the
+// catalog and referrers. It can require basic or token auth and can be told to fail requests.
+type Registry struct {
+	// Server is the running server; its URL is the base URL of the registry.
+	Server *httptest.Server
+
+	mutex        sync.Mutex
+	username     string
+	password     string
+	tokenAuth    bool
+	tokens       map[string][]string
+	repositories map[string]*repository
+	blobs        map[digest.Digest][]byte
+	uploads      map[string]*upload
+	nextUpload   int
+	faults       []*Fault
+	requests     []string
+}
+
+type repository struct {
+	manifests map[digest.Digest]*manifest
+	tags      map[string]digest.Digest
+	blobs     map[digest.Digest]bool
+}
+
+type manifest struct {
+	mediaType string
+	payload   []byte
+	fields    manifestFields
+}
+
+// manifestFields are the fields of image manifests and indexes that the registry looks at.
+type manifestFields struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType"`
+	Config       *v1.Descriptor    `json:"config"`
+	Layers       []v1.Descriptor   `json:"layers"`
+	Manifests    []v1.Descriptor   `json:"manifests"`
+	Subject      *v1.Descriptor    `json:"subject"`
+	Annotations  map[string]string `json:"annotations"`
+}
+
+type upload struct {
+	repository string
+	content    []byte
+}
+
+// Fault makes the registry fail, or delay, the requests it matches.
+type Fault struct {
+	// Method is the HTTP method to match, or empty to match any.
+	Method string
+	// Path is a regular expression matched against the request path, or empty to match any.
+	Path string
+	// StatusCode is the status code to respond with, or zero to only delay the request.
+	StatusCode int
+	// Delay is how long to wait before handling the request.
+	Delay time.Duration
+	// Times is the number of requests to affect, or zero for all of them.
+	Times int
+
+	path *regexp.Regexp
+}
+
+// CreateRegistry starts an empty Registry that doesn't require auth. Close must be called when done with it.
+func CreateRegistry() *Registry {
+	r := &Registry{
+		tokens:       make(map[string][]string),
+		repositories: make(map[string]*repository),
+		blobs:        make(map[digest.Digest][]byte),
+		uploads:      make(map[string]*upload),
+	}
+	r.Server = httptest.NewServer(r)
+	return r
+}
+
+// Close shuts the registry down.
+func (r *Registry) Close() {
+	r.Server.Close()
+}
+
+// Host returns the host:port of the registry, as used in image names and docker config auths.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.Server.URL, "http://")
+}
+
+// ManifestURL returns the URL of the manifest with the tag or digest in the repository.
+func (r *Registry) ManifestURL(name string, reference string) string {
+	return r.Server.URL + "/v2/" + name + "/manifests/" + reference
+}
+
+// SetBasicAuth makes the registry require basic auth with the username and password.
+func (r *Registry) SetBasicAuth(username string, password string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.username, r.password, r.tokenAuth = username, password, false
+}
+
+// SetTokenAuth makes the registry require bearer tokens, issued by its /token endpoint for the scopes asked for. The
+// token endpoint requires basic auth with the username and password, unless the username is empty, in which case
+// tokens are issued anonymously.
+func (r *Registry) SetTokenAuth(username string, password string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.username, r.password, r.tokenAuth = username, password, true
+}
+
+// AddFault adds a fault; the first matching fault is applied to each request.
+func (r *Registry) AddFault(fault Fault) {
+	if fault.Path != "" {
+		fault.path = regexp.MustCompile(fault.Path)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.faults = append(r.faults, &fault)
+}
+
+// Requests returns the requests handled so far, as "METHOD /path?query".
+func (r *Registry) Requests() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+// PutBlob adds the blob to the repository, returning its digest.
+func (r *Registry) PutBlob(name string, content []byte) digest.Digest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	d := digest.FromBytes(content)
+	r.blobs[d] = content
+	r.repository(name).blobs[d] = true
+	return d
+}
+
+// PutManifest adds the manifest to the repository, tagging it if the reference is a tag, and returns its digest.
+// Unlike a PUT request, it doesn't check that the blobs the manifest refers to exist.
+func (r *Registry) PutManifest(name string, reference string, mediaType string, payload []byte) digest.Digest {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	d, _ := r.putManifest(name, reference, mediaType, payload)
+	return d
+}
+
+// Manifest returns the payload of the manifest with the tag or digest in the repository.
+func (r *Registry) Manifest(name string, reference string) ([]byte, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	m, _ := r.manifest(name, reference)
+	if m == nil {
+		return nil, false
+	}
+	return m.payload, true
+}
+
+// Tags returns the sorted tags of the repository.
+func (r *Registry) Tags(name string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.sortedTags(name)
+}
+
+func (r *Registry) repository(name string) *repository {
+	repo, exists := r.repositories[name]
+	if !exists {
+		repo = &repository{
+			manifests: make(map[digest.Digest]*manifest),
+			tags:      make(map[string]digest.Digest),
+			blobs:     make(map[digest.Digest]bool),
+		}
+		r.repositories[name] = repo
+	}
+	return repo
+}
+
+// manifest returns the manifest with the tag or digest, or nil, along with its digest.
+func (r *Registry) manifest(name string, reference string) (*manifest, digest.Digest) {
+	repo, exists := r.repositories[name]
+	if !exists {
+		return nil, ""
+	}
+	d := digest.Digest(reference)
+	if d.Validate() != nil {
+		d = repo.tags[reference]
+	}
+	return repo.manifests[d], d
+}
+
+func (r *Registry) putManifest(name string, reference string, mediaType string, payload []byte) (digest.Digest, manifestFields) {
+	var fields manifestFields
+	json.Unmarshal(payload, &fields)
+	if mediaType == "" || mediaType == "application/json" {
+		mediaType = fields.MediaType
+	}
+	if mediaType == "" {
+		mediaType = v1.MediaTypeImageManifest
+	}
+	d := digest.FromBytes(payload)
+	repo := r.repository(name)
+	repo.manifests[d] = &manifest{mediaType: mediaType, payload: payload, fields: fields}
+	if digest.Digest(reference).Validate() != nil {
+		repo.tags[reference] = d
+	}
+	return d, fields
+}
+
+func (r *Registry) sortedTags(name string) []string {
+	var tags []string
+	if repo, exists := r.repositories[name]; exists {
+		for tag := range repo.tags {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.RequestURI())
+	fault := r.matchFault(req)
+	r.mutex.Unlock()
+	if fault != nil {
+		time.Sleep(fault.Delay)
+		if fault.StatusCode != 0 {
+			writeError(w, fault.StatusCode, "UNKNOWN", "injected fault")
+			return
+		}
+	}
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		http.NotFound(w, req)
+		return
+	}
+	var match []string
+	switch {
+	case req.URL.Path == "/v2/":
+		if r.authorize(w, req, "") {
+			w.WriteHeader(http.StatusOK)
+		}
+	case req.URL.Path == "/v2/_catalog":
+		if r.authorize(w, req, "registry:catalog:*") {
+			r.serveCatalog(w, req)
+		}
+	default:
+		for _, route := range []struct {
+			path  *regexp.Regexp
+			serve func(w http.ResponseWriter, req *http.Request, name string, reference string)
+		}{
+			{manifestPath, r.serveManifest},
+			{uploadPath, r.serveUpload},
+			{blobPath, r.serveBlob},
+			{tagsPath, r.serveTags},
+			{referrersPath, r.serveReferrers},
+		} {
+			if match = route.path.FindStringSubmatch(req.URL.Path); match != nil {
+				// pad the match so routes without a reference get an empty one
+				match = append(match, "")
+				if r.authorize(w, req, "repository:"+match[1]+":"+action(req.Method)) {
+					route.serve(w, req, match[1], match[2])
+				}
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown path "+req.URL.Path)
+	}
+}
+
+// matchFault returns the first fault matching the request, counting it against the fault's Times.
+func (r *Registry) matchFault(req *http.Request) *Fault {
+	for i, fault := range r.faults {
+		if (fault.Method != "" && fault.Method != req.Method) || (fault.path != nil && !fault.path.MatchString(req.URL.Path)) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				r.faults = append(r.faults[:i:i], r.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+	return nil
+}
+
+func action(method string) string {
+	switch method {
+	case "GET", "HEAD":
+		return "pull"
+	case "DELETE":
+		return "delete"
+	}
+	return "pull,push"
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, value interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	json.NewEncoder(w).Encode(value)
+}
+
+// authorize checks the request's credentials, writing a 401 response with a challenge if they are missing or wrong.
+func (r *Registry) authorize(w http.ResponseWriter, req *http.Request, scope string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.tokenAuth {
+		if r.granted(req, scope) {
+			return true
+		}
+		challenge := `Bearer realm="` + r.Server.URL + `/token",service="` + Service + `"`
+		if scope != "" {
+			challenge += `,scope="` + scope + `"`
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return false
+	}
+	if r.username == "" || r.checkBasicAuth(req) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+Service+`"`)
+	writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+	return false
+}
+
+// granted reports whether the request's token grants the scope, or true if the registry doesn't use tokens. The
+// caller must hold the mutex.
+func (r *Registry) granted(req *http.Request, scope string) bool {
+	if !r.tokenAuth {
+		return true
+	}
+	granted, exists := r.tokens[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+	return exists && hasScope(granted, scope)
+}
+
+func (r *Registry) checkBasicAuth(req *http.Request) bool {
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(r.username+":"+r.password))
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte(expected)) == 1
+}
+
+// hasScope reports whether the granted scopes cover the wanted one, where each is type:name:action[,action...].
+func hasScope(granted []string, wanted string) bool {
+	if wanted == "" {
+		return true
+	}
+	wantedParts := strings.SplitN(wanted, ":", 3)
+	if len(wantedParts) != 3 {
+		return false
+	}
+	for _, action := range strings.Split(wantedParts[2], ",") {
+		found := false
+		for _, scope := range granted {
+			parts := strings.SplitN(scope, ":", 3)
+			if len(parts) != 3 || parts[0] != wantedParts[0] || parts[1] != wantedParts[1] {
+				continue
+			}
+			for _, grantedAction := range strings.Split(parts[2], ",") {
+				if grantedAction == action || grantedAction == "*" {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// serveToken issues a token for the scopes asked for.
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.username != "" && !r.checkBasicAuth(req) {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "bad credentials")
+		return
+	}
+	var scopes []string
+	for _, scope := range req.URL.Query()["scope"] {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	token := "token-" + strconv.Itoa(len(r.tokens)+1)
+	r.tokens[token] = scopes
+	writeJSON(w, "application/json", map[string]interface{}{
+		"token":        token,
+		"access_token": token,
+		"expires_in":   300,
+		"issued_at":    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// page applies the n and last query parameters to the sorted names, adding a Link header if there are more.
+func page(w http.ResponseWriter, req *http.Request, names []string) []string {
+	query := req.URL.Query()
+	if last := query.Get("last"); last != "" {
+		names = names[sort.SearchStrings(names, last):]
+		if len(names) > 0 && names[0] == last {
+			names = names[1:]
+		}
+	}
+	n, err := strconv.Atoi(query.Get("n"))
+	if err != nil || n <= 0 || n >= len(names) {
+		return names
+	}
+	names = names[:n]
+	next := req.URL.Path + "?" + url.Values{"n": {strconv.Itoa(n)}, "last": {names[n-1]}}.Encode()
+	w.Header().Set("Link", "<"+next+`>; rel="next"`)
+	return names
+}
+
+func (r *Registry) serveCatalog(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	var names []string
+	for name := range r.repositories {
+		names = append(names, name)
+	}
+	r.mutex.Unlock()
+	sort.Strings(names)
+	writeJSON(w, "application/json", map[string][]string{"repositories": page(w, req, names)})
+}
+
+func (r *Registry) serveTags(w http.ResponseWriter, req *http.Request, name string, _ string) {
+	r.mutex.Lock()
+	_, exists := r.repositories[name]
+	tags := r.sortedTags(name)
+	r.mutex.Unlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	writeJSON(w, "application/json", map[string]interface{}{"name": name, "tags": page(w, req, tags)})
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, name string, reference string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch req.Method {
+	case "GET", "HEAD":
+		m, d := r.manifest(name, reference)
+		if m == nil {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		etag := `"` + d.String() + `"`
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.payload)))
+		if req.Method == "GET" {
+			w.Write(m.payload)
+		}
+	case "PUT":
+		payload, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		if !r.checkPreconditions(w, req, name, reference) {
+			return
+		}
+		if d := digest.Digest(reference); d.Validate() == nil && d.Algorithm().FromBytes(payload) != d {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+			return
+		}
+		var fields manifestFields
+		if err = json.Unmarshal(payload, &fields); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		if missing := r.missingReferences(name, fields); missing != "" {
+			writeError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob unknown to registry: "+missing)
+			return
+		}
+		d, _ := r.putManifest(name, reference, req.Header.Get("Content-Type"), payload)
+		w.Header().Set("Location", "/v2/"+name+"/manifests/"+d.String())
+		w.Header().Set("Docker-Content-Digest", d.String())
+		if fields.Subject != nil {
+			w.Header().Set("OCI-Subject", fields.Subject.Digest.String())
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		m, d := r.manifest(name, reference)
+		if m == nil {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		repo := r.repositories[name]
+		if digest.Digest(reference).Validate() != nil {
+			delete(repo.tags, reference)
+		} else {
+			delete(repo.manifests, d)
+			for tag, tagged := range repo.tags {
+				if tagged == d {
+					delete(repo.tags, tag)
+				}
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// checkPreconditions applies If-Match and If-None-Match to the manifest's current ETag; the mutex must be held.
+func (r *Registry) checkPreconditions(w http.ResponseWriter, req *http.Request, name string, reference string) bool {
+	m, d := r.manifest(name, reference)
+	etag := ""
+	if m != nil {
+		etag = `"` + d.String() + `"`
+	}
+	ifMatch := req.Header.Get("If-Match")
+	ifNoneMatch := req.Header.Get("If-None-Match")
+	if (ifMatch != "" && ifMatch != etag && !(ifMatch == "*" && etag != "")) ||
+		(ifNoneMatch != "" && (ifNoneMatch == etag || (ifNoneMatch == "*" && etag != ""))) {
+		writeError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "precondition failed")
+		return false
+	}
+	return true
+}
+
+// missingReferences returns the digest of a blob or child manifest that the manifest refers to but the repository
+// doesn't have, or an empty string; the mutex must be held.
+func (r *Registry) missingReferences(name string, fields manifestFields) string {
+	repo := r.repositories[name]
+	if repo == nil {
+		repo = &repository{}
+	}
+	descriptors := append([]v1.Descriptor(nil), fields.Layers...)
+	if fields.Config != nil {
+		descriptors = append(descriptors, *fields.Config)
+	}
+	for _, descriptor := range descriptors {
+		if !repo.blobs[descriptor.Digest] {
+			return descriptor.Digest.String()
+		}
+	}
+	for _, descriptor := range fields.Manifests {
+		if repo.manifests[descriptor.Digest] == nil {
+			return descriptor.Digest.String()
+		}
+	}
+	return ""
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, name string, reference string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	d := digest.Digest(reference)
+	repo, exists := r.repositories[name]
+	if d.Validate() != nil || !exists || !repo.blobs[d] {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+		content := r.blobs[d]
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if req.Method == "GET" {
+			w.Write(content)
+		}
+	case "DELETE":
+		delete(repo.blobs, d)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, name string, id string) {
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	query := req.URL.Query()
+	if req.Method == "POST" && id == "" {
+		if mount := digest.Digest(query.Get("mount")); mount != "" {
+			from, exists := r.repositories[query.Get("from")]
+			if exists && from.blobs[mount] && r.granted(req, "repository:"+query.Get("from")+":pull") {
+				r.repository(name).blobs[mount] = true
+				w.Header().Set("Location", "/v2/"+name+"/blobs/"+mount.String())
+				w.Header().Set("Docker-Content-Digest", mount.String())
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		if d := digest.Digest(query.Get("digest")); d != "" {
+			r.completeUpload(w, name, d, content)
+			return
+		}
+		r.nextUpload++
+		id = "upload-" + strconv.Itoa(r.nextUpload)
+		r.uploads[id] = &upload{repository: name}
+		r.writeUploadStatus(w, name, id, http.StatusAccepted)
+		return
+	}
+	u, exists := r.uploads[id]
+	if !exists || u.repository != name {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+	switch req.Method {
+	case "GET":
+		r.writeUploadStatus(w, name, id, http.StatusNoContent)
+	case "PATCH":
+		u.content = append(u.content, content...)
+		r.writeUploadStatus(w, name, id, http.StatusAccepted)
+	case "PUT":
+		delete(r.uploads, id)
+		r.completeUpload(w, name, digest.Digest(query.Get("digest")), append(u.content, content...))
+	case "DELETE":
+		delete(r.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+func (r *Registry) writeUploadStatus(w http.ResponseWriter, name string, id string, statusCode int) {
+	end := len(r.uploads[id].content) - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Location", "/v2/"+name+"/blobs/uploads/"+id)
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", "0-"+strconv.Itoa(end))
+	w.WriteHeader(statusCode)
+}
+
+// completeUpload stores the uploaded content if it matches the digest; the mutex must be held.
+func (r *Registry) completeUpload(w http.ResponseWriter, name string, d digest.Digest, content []byte) {
+	if d.Validate() != nil || d.Algorithm().FromBytes(content) != d {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+		return
+	}
+	r.blobs[d] = content
+	r.repository(name).blobs[d] = true
+	w.Header().Set("Location", "/v2/"+name+"/blobs/"+d.String())
+	w.Header().Set("Docker-Content-Digest", d.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (r *Registry) serveReferrers(w http.ResponseWriter, req *http.Request, name string, reference string) {
+	if req.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	subject := digest.Digest(reference)
+	if subject.Validate() != nil {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest")
+		return
+	}
+	artifactType := req.URL.Query().Get("artifactType")
+	index := v1.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: v1.MediaTypeImageIndex, Manifests: []v1.Descriptor{}}
+	r.mutex.Lock()
+	if repo, exists := r.repositories[name]; exists {
+		for d, m := range repo.manifests {
+			if m.fields.Subject == nil || m.fields.Subject.Digest != subject {
+				continue
+			}
+			descriptor := v1.Descriptor{
+				MediaType:    m.mediaType,
+				ArtifactType: m.fields.ArtifactType,
+				Digest:       d,
+				Size:         int64(len(m.payload)),
+				Annotations:  m.fields.Annotations,
+			}
+			if descriptor.ArtifactType == "" && m.fields.Config != nil {
+				descriptor.ArtifactType = m.fields.Config.MediaType
+			}
+			if artifactType == "" || descriptor.ArtifactType == artifactType {
+				index.Manifests = append(index.Manifests, descriptor)
+			}
+		}
+	}
+	r.mutex.Unlock()
+	sort.Slice(index.Manifests, func(i, j int) bool { return index.Manifests[i].Digest < index.Manifests[j].Digest })
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	writeJSON(w, v1.MediaTypeImageIndex, index)
+}
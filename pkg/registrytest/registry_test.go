@@ -0,0 +1,211 @@
+package registrytest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/vleurgat/dockerclient/pkg/client"
+)
+
+func createClient(r *Registry, username string, password string) *client.Client {
+	config := &configfile.ConfigFile{AuthConfigs: map[string]types.AuthConfig{}}
+	if username != "" {
+		config.AuthConfigs[r.Host()] = types.AuthConfig{Username: username, Password: password}
+	}
+	c := client.CreateClient(config)
+	return &c
+}
+
+// pushImage pushes a single layer image with the client, returning the manifest.
+func pushImage(t *testing.T, c *client.Client, url string) client.Manifest {
+	ref, err := client.ParseReference(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := schema2.Manifest{Versioned: schema2.SchemaVersion}
+	if manifest.Config, err = c.PutBlob(ref, schema2.MediaTypeImageConfig, []byte(`{"os":"linux"}`)); err != nil {
+		t.Fatal("failed to push config", err)
+	}
+	layer, err := c.PutBlob(ref, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatal("failed to push layer", err)
+	}
+	manifest.Layers = append(manifest.Layers, layer)
+	payload, _ := json.Marshal(manifest)
+	pushed := client.Manifest{MediaType: schema2.MediaTypeManifest, Digest: digest.FromBytes(payload), Payload: payload}
+	if err = c.PutManifest(url, pushed); err != nil {
+		t.Fatal("failed to push manifest", err)
+	}
+	return pushed
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("push and pull", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		c := createClient(r, "", "")
+		pushed := pushImage(t, c, r.ManifestURL("team/app", "v1"))
+		pulled, err := c.GetManifest(r.ManifestURL("team/app", "v1"))
+		if err != nil || pulled.Digest != pushed.Digest || pulled.MediaType != schema2.MediaTypeManifest {
+			t.Fatalf("expected the pushed manifest; got %+v and %v", pulled, err)
+		}
+		repo, _ := client.ParseReference(r.ManifestURL("team/app", "v1"))
+		if tags, err := c.ListTags(repo); err != nil || strings.Join(tags, ",") != "v1" {
+			t.Errorf("expected tag v1; got %s and %v", tags, err)
+		}
+		if err = c.DeleteManifest(r.ManifestURL("team/app", pushed.Digest.String())); err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		if _, err = c.HeadManifest(r.ManifestURL("team/app", "v1")); !client.IsNotFound(err) {
+			t.Errorf("expected not found after delete; got %v", err)
+		}
+	})
+
+	t.Run("missing blobs", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		payload := `{"schemaVersion":2,"mediaType":"` + schema2.MediaTypeManifest + `","config":{"digest":"` + digest.FromString("x").String() + `"},"layers":[]}`
+		c := createClient(r, "", "")
+		err := c.PutManifest(r.ManifestURL("app", "v1"), client.Manifest{MediaType: schema2.MediaTypeManifest, Payload: []byte(payload)})
+		if err == nil || !strings.Contains(err.Error(), "400") {
+			t.Errorf("expected status code 400; got %v", err)
+		}
+	})
+
+	t.Run("basic auth", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		r.SetBasicAuth("user", "secret")
+		pushImage(t, createClient(r, "user", "secret"), r.ManifestURL("app", "v1"))
+		_, err := createClient(r, "user", "wrong").GetManifest(r.ManifestURL("app", "v1"))
+		if err == nil {
+			t.Error("expected an error with the wrong password")
+		}
+	})
+
+	t.Run("token auth", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		r.SetTokenAuth("user", "secret")
+		c := createClient(r, "user", "secret")
+		pushImage(t, c, r.ManifestURL("app", "v1"))
+		if _, err := c.GetManifest(r.ManifestURL("app", "v1")); err != nil {
+			t.Errorf("expected nil error; got %s", err)
+		}
+		found := false
+		for _, request := range r.Requests() {
+			found = found || strings.HasPrefix(request, "GET /token?")
+		}
+		if !found {
+			t.Errorf("expected a token request; got %s", r.Requests())
+		}
+		if _, err := createClient(r, "user", "wrong").GetManifest(r.ManifestURL("app", "v1")); err == nil {
+			t.Error("expected an error with the wrong password")
+		}
+	})
+
+	t.Run("faults", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		r.PutManifest("app", "v1", v1.MediaTypeImageManifest, []byte(`{"schemaVersion":2}`))
+		r.AddFault(Fault{Method: "GET", Path: "/manifests/", StatusCode: 503, Times: 1})
+		c := createClient(r, "", "")
+		if _, err := c.GetManifest(r.ManifestURL("app", "v1")); err == nil || !strings.Contains(err.Error(), "503") {
+			t.Errorf("expected status code 503; got %v", err)
+		}
+		if _, err := c.GetManifest(r.ManifestURL("app", "v1")); err != nil {
+			t.Errorf("expected the fault to have cleared; got %s", err)
+		}
+	})
+
+	t.Run("catalog", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		for _, name := range []string{"c", "a", "b"} {
+			r.PutBlob(name, []byte(name))
+		}
+		response, err := http.Get(r.Server.URL + "/v2/_catalog?n=2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var catalog struct {
+			Repositories []string `json:"repositories"`
+		}
+		json.NewDecoder(response.Body).Decode(&catalog)
+		if strings.Join(catalog.Repositories, ",") != "a,b" {
+			t.Errorf("expected a,b; got %s", catalog.Repositories)
+		}
+		if link := response.Header.Get("Link"); link != `</v2/_catalog?last=b&n=2>; rel="next"` {
+			t.Errorf("unexpected Link header; got %s", link)
+		}
+	})
+
+	t.Run("chunked upload", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		response, err := http.Post(r.Server.URL+"/v2/app/blobs/uploads/", "", nil)
+		if err != nil || response.StatusCode != 202 {
+			t.Fatalf("expected 202; got %v and %v", response, err)
+		}
+		location := r.Server.URL + response.Header.Get("Location")
+		for _, chunk := range []string{"hello ", "world"} {
+			request, _ := http.NewRequest("PATCH", location, strings.NewReader(chunk))
+			if response, err = http.DefaultClient.Do(request); err != nil || response.StatusCode != 202 {
+				t.Fatalf("expected 202; got %v and %v", response, err)
+			}
+		}
+		d := digest.FromString("hello world")
+		request, _ := http.NewRequest("PUT", location+"?digest="+d.String(), nil)
+		if response, err = http.DefaultClient.Do(request); err != nil || response.StatusCode != 201 {
+			t.Fatalf("expected 201; got %v and %v", response, err)
+		}
+		ref, _ := client.ParseReference(r.ManifestURL("app", "latest"))
+		if blob, err := createClient(r, "", "").GetBlob(ref.BlobURL(d)); err != nil || string(blob) != "hello world" {
+			t.Errorf("expected hello world; got %s and %v", blob, err)
+		}
+	})
+
+	t.Run("referrers", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		c := createClient(r, "", "")
+		subject := pushImage(t, c, r.ManifestURL("app", "v1"))
+		repo, _ := client.ParseReference(r.ManifestURL("app", "v1"))
+		descriptor, err := c.PushArtifact(repo.WithTag("sbom"), client.Artifact{
+			ArtifactType: "application/spdx+json",
+			Blobs:        []client.ArtifactBlob{{MediaType: "application/spdx+json", Content: []byte("{}")}},
+			Subject:      &v1.Descriptor{MediaType: subject.MediaType, Digest: subject.Digest, Size: int64(len(subject.Payload))},
+		})
+		if err != nil {
+			t.Fatalf("expected nil error; got %s", err)
+		}
+		referrers, err := c.ListReferrers(repo, subject.Digest, "application/spdx+json")
+		if err != nil || len(referrers) != 1 || referrers[0].Digest != descriptor.Digest {
+			t.Errorf("expected the artifact as the only referrer; got %+v and %v", referrers, err)
+		}
+		if tags := r.Tags("app"); strings.Join(tags, ",") != "sbom,v1" {
+			t.Errorf("expected no referrers tag; got %s", tags)
+		}
+	})
+
+	t.Run("conditional put", func(t *testing.T) {
+		r := CreateRegistry()
+		defer r.Close()
+		r.PutManifest("app", "stable", v1.MediaTypeImageManifest, []byte(`{"schemaVersion":2}`))
+		payload := `{"schemaVersion":2,"layers":[]}`
+		request, _ := http.NewRequest("PUT", r.ManifestURL("app", "stable"), strings.NewReader(payload))
+		request.Header.Set("If-Match", `"`+digest.FromString("other").String()+`"`)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil || response.StatusCode != 412 {
+			t.Errorf("expected 412; got %v and %v", response, err)
+		}
+	})
+}
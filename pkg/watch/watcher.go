@@ -0,0 +1,238 @@
+package watch
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+	"github.com/vleurgat/dockerclient/pkg/client"
+)
+
+// EventType says what happened to a watched tag.
+type EventType string
+
+const (
+	// Created means the tag has appeared.
+	Created EventType = "created"
+	// Updated means the tag now points at a different digest.
+	Updated EventType = "updated"
+	// Deleted means the tag has gone.
+	Deleted EventType = "deleted"
+)
+
+// Event reports a change to a watched tag.
+type Event struct {
+	Type      EventType     `json:"type"`
+	Reference string        `json:"reference"`
+	OldDigest digest.Digest `json:"oldDigest,omitempty"`
+	NewDigest digest.Digest `json:"newDigest,omitempty"`
+	Time      time.Time     `json:"time"`
+}
+
+// Registry is the part of client.Client that the Watcher uses.
+type Registry interface {
+	HeadManifest(url string) (distribution.Descriptor, error)
+	GetManifest(url string) (client.Manifest, error)
+	ListTags(repo client.Reference) ([]string, error)
+}
+
+// Watcher periodically resolves a set of image references and reports tags that have been created, updated or
+// deleted since the previous poll. The tag of a reference may be a glob, such as my.host/repo:v1.*, in which case all
+// the matching tags in the repository are watched.
+type Watcher struct {
+	// Interval is the time between polls.
+	Interval time.Duration
+	// Jitter is the maximum random time added to each Interval, to stop many watchers polling in lock step.
+	Jitter time.Duration
+	// RateLimits limits the requests per second made to each registry host. Hosts not listed are not limited.
+	RateLimits map[string]float64
+
+	registry Registry
+	refs     []string
+	state    map[string]map[string]digest.Digest
+	limiters map[string]*limiter
+}
+
+// CreateWatcher creates a Watcher for the references, which may be registry manifest URLs or Docker style image names.
+func CreateWatcher(registry Registry, interval time.Duration, refs ...string) *Watcher {
+	return &Watcher{
+		Interval: interval,
+		registry: registry,
+		refs:     refs,
+		state:    make(map[string]map[string]digest.Digest),
+		limiters: make(map[string]*limiter),
+	}
+}
+
+// Watch polls until the context is done, sending events on the returned channel, which is closed when it stops. The
+// first poll establishes what is there, so only changes after that are reported.
+func (w *Watcher) Watch(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		initial := true
+		for {
+			for _, event := range w.poll(ctx) {
+				if initial {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			initial = false
+			wait := w.Interval
+			if w.Jitter > 0 {
+				wait += time.Duration(rand.Int63n(int64(w.Jitter)))
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// poll resolves every reference once, returning the changes since the previous poll.
+func (w *Watcher) poll(ctx context.Context) []Event {
+	var events []Event
+	for _, pattern := range w.refs {
+		current, err := w.resolve(ctx, pattern)
+		if err != nil {
+			log.Println("failed to resolve", pattern, err)
+			continue
+		}
+		events = append(events, diffState(w.state[pattern], current)...)
+		w.state[pattern] = current
+	}
+	return events
+}
+
+// resolve returns the digest of every tag matching the pattern, or the digest a pattern is pinned to. Tags that cannot
+// be resolved because of an error other than not found keep their previous digest, so transient errors aren't
+// reported as deletions.
+func (w *Watcher) resolve(ctx context.Context, pattern string) (map[string]digest.Digest, error) {
+	ref, err := client.ParseReference(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest != "" {
+		// a pinned digest never moves, so there's nothing to ask the registry
+		return map[string]digest.Digest{ref.String(): ref.Digest}, nil
+	}
+	tags := []string{ref.Tag}
+	if strings.ContainsAny(ref.Tag, "*?[") {
+		if err = w.wait(ctx, ref.Host); err != nil {
+			return nil, err
+		}
+		all, err := w.registry.ListTags(ref)
+		if err != nil && !client.IsNotFound(err) {
+			return nil, err
+		}
+		tags = nil
+		for _, tag := range all {
+			if matched, _ := path.Match(ref.Tag, tag); matched {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	previous := w.state[pattern]
+	current := make(map[string]digest.Digest)
+	for _, tag := range tags {
+		tagged := ref.WithTag(tag)
+		if err = w.wait(ctx, ref.Host); err != nil {
+			return nil, err
+		}
+		d, err := w.digest(tagged)
+		if client.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Println("failed to resolve", tagged, err)
+			if old, exists := previous[tagged.String()]; exists {
+				current[tagged.String()] = old
+			}
+			continue
+		}
+		current[tagged.String()] = d
+	}
+	return current, nil
+}
+
+// digest asks for the digest with a HEAD request, falling back to fetching the manifest for registries that don't
+// send a Docker-Content-Digest header.
+func (w *Watcher) digest(ref client.Reference) (digest.Digest, error) {
+	descriptor, err := w.registry.HeadManifest(ref.ManifestURL())
+	if err != nil || descriptor.Digest != "" {
+		return descriptor.Digest, err
+	}
+	manifest, err := w.registry.GetManifest(ref.ManifestURL())
+	return manifest.Digest, err
+}
+
+func diffState(previous, current map[string]digest.Digest) []Event {
+	now := time.Now()
+	var events []Event
+	for ref, d := range current {
+		old, exists := previous[ref]
+		if !exists {
+			events = append(events, Event{Type: Created, Reference: ref, NewDigest: d, Time: now})
+		} else if old != d {
+			events = append(events, Event{Type: Updated, Reference: ref, OldDigest: old, NewDigest: d, Time: now})
+		}
+	}
+	for ref, d := range previous {
+		if _, exists := current[ref]; !exists {
+			events = append(events, Event{Type: Deleted, Reference: ref, OldDigest: d, Time: now})
+		}
+	}
+	return events
+}
+
+// wait blocks until a request may be made to the host without exceeding its rate limit.
+func (w *Watcher) wait(ctx context.Context, host string) error {
+	rate := w.RateLimits[host]
+	if rate <= 0 {
+		return ctx.Err()
+	}
+	l, exists := w.limiters[host]
+	if !exists {
+		l = &limiter{interval: time.Duration(float64(time.Second) / rate)}
+		w.limiters[host] = l
+	}
+	return l.wait(ctx)
+}
+
+// limiter spaces requests out so that they are at least interval apart.
+type limiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mutex.Unlock()
+	select {
+	case <-time.After(start.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+	"github.com/vleurgat/dockerclient/pkg/client"
+)
+
+// fakeRegistry serves digests from a map of manifest URL to digest, which the tests change between polls.
+type fakeRegistry struct {
+	mutex   sync.Mutex
+	digests map[string]digest.Digest
+	tags    []string
+	failing bool
+}
+
+func (r *fakeRegistry) set(url string, d digest.Digest, tags ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if d == "" {
+		delete(r.digests, url)
+	} else {
+		r.digests[url] = d
+	}
+	if tags != nil {
+		r.tags = tags
+	}
+}
+
+func (r *fakeRegistry) HeadManifest(url string) (distribution.Descriptor, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.failing {
+		return distribution.Descriptor{}, errors.New("registry unavailable")
+	}
+	d, exists := r.digests[url]
+	if !exists {
+		return distribution.Descriptor{}, client.StatusError{StatusCode: 404}
+	}
+	return distribution.Descriptor{Digest: d}, nil
+}
+
+func (r *fakeRegistry) GetManifest(url string) (client.Manifest, error) {
+	descriptor, err := r.HeadManifest(url)
+	return client.Manifest{Digest: descriptor.Digest}, err
+}
+
+func (r *fakeRegistry) ListTags(repo client.Reference) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.tags...), nil
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func TestWatch(t *testing.T) {
+	latest := "https://hello.io/v2/repo/manifests/latest"
+	v10 := "https://hello.io/v2/repo/manifests/v1.0"
+	v11 := "https://hello.io/v2/repo/manifests/v1.1"
+
+	t.Run("single tag", func(t *testing.T) {
+		registry := &fakeRegistry{digests: map[string]digest.Digest{latest: "sha256:aaa"}}
+		watcher := CreateWatcher(registry, time.Millisecond, "hello.io/repo:latest")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := watcher.Watch(ctx)
+		time.Sleep(10 * time.Millisecond)
+		registry.set(latest, "sha256:bbb")
+		event := nextEvent(t, events)
+		if event.Type != Updated || event.OldDigest != "sha256:aaa" || event.NewDigest != "sha256:bbb" {
+			t.Errorf("expected update from aaa to bbb; got %+v", event)
+		}
+		registry.set(latest, "")
+		event = nextEvent(t, events)
+		if event.Type != Deleted || event.Reference != "hello.io/repo:latest" || event.OldDigest != "sha256:bbb" {
+			t.Errorf("expected delete of hello.io/repo:latest; got %+v", event)
+		}
+		registry.set(latest, "sha256:ccc")
+		event = nextEvent(t, events)
+		if event.Type != Created || event.NewDigest != "sha256:ccc" {
+			t.Errorf("expected create of ccc; got %+v", event)
+		}
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		registry := &fakeRegistry{digests: map[string]digest.Digest{v10: "sha256:aaa", latest: "sha256:bbb"}, tags: []string{"v1.0", "latest"}}
+		watcher := CreateWatcher(registry, time.Millisecond, "hello.io/repo:v1.*")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := watcher.Watch(ctx)
+		time.Sleep(10 * time.Millisecond)
+		registry.set(latest, "sha256:ccc")
+		registry.set(v11, "sha256:ddd", "v1.0", "v1.1", "latest")
+		event := nextEvent(t, events)
+		if event.Type != Created || event.Reference != "hello.io/repo:v1.1" || event.NewDigest != "sha256:ddd" {
+			t.Errorf("expected create of hello.io/repo:v1.1; got %+v", event)
+		}
+	})
+
+	t.Run("errors are not deletions", func(t *testing.T) {
+		registry := &fakeRegistry{digests: map[string]digest.Digest{latest: "sha256:aaa"}}
+		watcher := CreateWatcher(registry, time.Millisecond, "hello.io/repo:latest")
+		watcher.poll(context.Background())
+		registry.failing = true
+		if events := watcher.poll(context.Background()); len(events) != 0 {
+			t.Errorf("expected no events; got %+v", events)
+		}
+		registry.failing = false
+		registry.set(latest, "sha256:bbb")
+		if events := watcher.poll(context.Background()); len(events) != 1 || events[0].Type != Updated {
+			t.Errorf("expected an update; got %+v", events)
+		}
+	})
+
+	t.Run("pinned digest", func(t *testing.T) {
+		pinned := "hello.io/repo@" + digest.FromString("pinned").String()
+		watcher := CreateWatcher(&fakeRegistry{failing: true}, time.Millisecond, pinned)
+		current, err := watcher.resolve(context.Background(), pinned)
+		if err != nil || len(current) != 1 || current[pinned] != digest.FromString("pinned") {
+			t.Errorf("expected the pinned digest; got %v and %v", current, err)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		registry := &fakeRegistry{digests: map[string]digest.Digest{}}
+		watcher := CreateWatcher(registry, time.Hour, "hello.io/repo:latest")
+		ctx, cancel := context.WithCancel(context.Background())
+		events := watcher.Watch(ctx)
+		cancel()
+		select {
+		case _, open := <-events:
+			if open {
+				t.Error("expected no events")
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("expected the channel to be closed")
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		registry := &fakeRegistry{digests: map[string]digest.Digest{v10: "sha256:aaa", v11: "sha256:bbb"}, tags: []string{"v1.0", "v1.1"}}
+		watcher := CreateWatcher(registry, time.Millisecond, "hello.io/repo:v1.*")
+		watcher.RateLimits = map[string]float64{"hello.io": 20}
+		start := time.Now()
+		watcher.poll(context.Background())
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("expected three requests at 20 per second to take at least 100ms; took %s", elapsed)
+		}
+	})
+}